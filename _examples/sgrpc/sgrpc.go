@@ -0,0 +1,86 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/netsec-ethz/scion-apps/pkg/sgrpc"
+)
+
+func main() {
+	var err error
+	port := flag.Uint("port", 0, "[Server] local port to listen on")
+	remoteAddr := flag.String("remote", "", "[Client] Remote (i.e. the server's) SCION Address (e.g. 17-ffaa:1:1,[127.0.0.1]:12345)")
+	service := flag.String("service", "", "[Client] Name of the service to check, empty for the server as a whole")
+	flag.Parse()
+
+	if (*port > 0) == (len(*remoteAddr) > 0) {
+		check(fmt.Errorf("Either specify -port for server or -remote for client"))
+	}
+
+	if *port > 0 {
+		err = runServer(uint16(*port))
+		check(err)
+	} else {
+		err = runClient(*remoteAddr, *service)
+		check(err)
+	}
+}
+
+func runServer(port uint16) error {
+	listener, err := sgrpc.ListenPort(port)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	return server.Serve(listener)
+}
+
+func runClient(address, service string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// the server uses a dummy certificate, which cannot be verified
+	conn, err := sgrpc.Dial(ctx, address, nil, grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Status: %s\n", resp.Status)
+	return nil
+}
+
+// Check just ensures the error is nil, or complains and quits
+func check(e error) {
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "Fatal error. Exiting.", "err", e)
+		os.Exit(1)
+	}
+}
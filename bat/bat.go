@@ -36,6 +36,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	"github.com/netsec-ethz/scion-apps/pkg/shttp"
 )
 
@@ -48,7 +49,7 @@ const (
 )
 
 var (
-	interactive      bool
+	pathConf         = pathselection.DefaultConfig()
 	ver              bool
 	form             bool
 	pretty           bool
@@ -70,7 +71,7 @@ var (
 )
 
 func init() {
-	flag.BoolVar(&interactive, "in", false, "Lets user choose the path to destination")
+	pathConf.RegisterFlags(flag.CommandLine)
 	flag.BoolVar(&ver, "v", false, "Print Version Number")
 	flag.BoolVar(&ver, "version", false, "Print Version Number")
 	flag.BoolVar(&pretty, "pretty", true, "Print Json Pretty Format")
@@ -97,7 +98,7 @@ func init() {
 	flag.Usage = usage
 	flag.Parse()
 
-	defaultSetting.Transport = shttp.NewRoundTripper(&tls.Config{InsecureSkipVerify: true}, nil)
+	defaultSetting.Transport = shttp.NewRoundTripperWithPathSelection(&tls.Config{InsecureSkipVerify: true}, nil, pathConf)
 }
 
 func parsePrintOption(s string) {
@@ -371,6 +372,8 @@ flags:
   -p, -pretty=true            Print Json Pretty Format
   -i, -insecure=false         Allow connections to SSL sites without certs
   -proxy=PROXY_URL            Proxy with host and port
+  -path-select=first          Path selection strategy, see pathselection package
+  -path-policy=FILE[:NAME]    Path policy JSON file, optionally with policy name
   -print="A"                  String specifying what the output should contain, default will print all information
          "H" request headers
          "B" request body
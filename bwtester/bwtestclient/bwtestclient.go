@@ -34,6 +34,7 @@ import (
 
 	. "github.com/netsec-ethz/scion-apps/bwtester/bwtestlib"
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
 )
@@ -263,6 +264,7 @@ func main() {
 		serverBwp    BwtestParameters
 		interactive  bool
 		pathAlgo     string
+		pathConf     = pathselection.DefaultConfig()
 
 		err   error
 		tzero time.Time // initialized to "zero" time
@@ -274,8 +276,9 @@ func main() {
 	flag.StringVar(&serverCCAddrStr, "s", "", "Server SCION Address")
 	flag.StringVar(&serverBwpStr, "sc", DefaultBwtestParameters, "Server->Client test parameter")
 	flag.StringVar(&clientBwpStr, "cs", DefaultBwtestParameters, "Client->Server test parameter")
-	flag.BoolVar(&interactive, "i", false, "Interactive path selection, prompt to choose path")
-	flag.StringVar(&pathAlgo, "pathAlgo", "", "Path selection algorithm / metric (\"shortest\", \"mtu\")")
+	flag.BoolVar(&interactive, "i", false, "Interactive path selection, prompt to choose path. Shorthand for -path-select=interactive")
+	flag.StringVar(&pathAlgo, "pathAlgo", "", "Deprecated, use -path-select")
+	pathConf.RegisterFlags(flag.CommandLine)
 
 	flag.Parse()
 	flagset := make(map[string]bool)
@@ -296,21 +299,19 @@ func main() {
 		Check(fmt.Errorf("Error, server address needs to be specified with -s"))
 	}
 
-	var path snet.Path
 	if interactive {
-		path, err = appnet.ChoosePathInteractive(serverCCAddr.IA)
-		Check(err)
-	} else {
-		var metric int
-		if pathAlgo == "mtu" {
-			metric = appnet.MTU
-		} else if pathAlgo == "shortest" {
-			metric = appnet.Shortest
-		}
-		path, err = appnet.ChoosePathByMetric(metric, serverCCAddr.IA)
-		Check(err)
+		pathConf.Select = "interactive"
+	} else if pathAlgo != "" {
+		pathConf.Select = pathAlgo
 	}
-	if path != nil {
+	selector, err := pathConf.NewSelector()
+	Check(err)
+	var path snet.Path
+	paths, err := appnet.QueryPaths(serverCCAddr.IA)
+	Check(err)
+	if len(paths) > 0 {
+		path, err = selector.Select(paths)
+		Check(err)
 		appnet.SetPath(serverCCAddr, path)
 	}
 
@@ -330,9 +331,10 @@ func main() {
 		context.TODO(), "udp", clientDCAddr, serverDCAddr, addr.SvcNone)
 	Check(err)
 
-	// update default packet size to max MTU on the selected path
+	// update default packet size to the largest payload fitting the MTU of
+	// the selected path
 	if path != nil {
-		InferedPktSize = int64(path.Metadata().MTU)
+		InferedPktSize = int64(appnet.MaxPayloadSize(path))
 	} else {
 		// use default packet size when within same AS and pathEntry is not set
 		InferedPktSize = DefaultPktSize
@@ -350,7 +352,7 @@ func main() {
 	serverBwp = parseBwtestParameters(serverBwpStr)
 	serverBwp.Port = uint16(serverDCAddr.Host.Port)
 	fmt.Println("\nTest parameters:")
-	fmt.Println("clientDCAddr -> serverDCAddr", clientDCAddr, "->", serverDCAddr)
+	fmt.Println("clientDCAddr -> serverDCAddr", appnet.FormatAddr(clientDCAddr), "->", appnet.FormatAddr(serverDCAddr))
 	fmt.Printf("client->server: %d seconds, %d bytes, %d packets\n",
 		int(clientBwp.BwtestDuration/time.Second), clientBwp.PacketSize, clientBwp.NumPackets)
 	fmt.Printf("server->client: %d seconds, %d bytes, %d packets\n",
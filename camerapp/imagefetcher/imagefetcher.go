@@ -36,9 +36,13 @@ const (
 
 	// Number of blocks that are simultaneously requested
 	maxNumBlocksRequested               = 5
-	blockSize             uint32        = 1000
+	maxBlockSize          uint32        = 1000
 	rttTimeoutMult        time.Duration = 3
 	consecReqWaitTime     time.Duration = 500 * time.Microsecond
+
+	// blockHeaderLen is the length of the header of block responses: 'G',
+	// start and end byte
+	blockHeaderLen = 9
 )
 
 func check(e error) {
@@ -47,9 +51,9 @@ func check(e error) {
 	}
 }
 
-func fetchFileInfo(udpConnection *snet.Conn) (string, uint32, time.Duration, error) {
+func fetchFileInfo(udpConnection *snet.Conn, packetSize int) (string, uint32, time.Duration, error) {
 	numRetries := 0
-	packetBuffer := make([]byte, 2500)
+	packetBuffer := make([]byte, packetSize)
 
 	for numRetries < maxRetries {
 		numRetries++
@@ -103,7 +107,8 @@ func fetchFileInfo(udpConnection *snet.Conn) (string, uint32, time.Duration, err
 	return "", 0, 0, fmt.Errorf("could not obtain file information")
 }
 
-func blockFetcher(fetchBlockChan chan uint32, udpConnection *snet.Conn, fileName string, fileSize uint32) {
+func blockFetcher(fetchBlockChan chan uint32, udpConnection *snet.Conn, fileName string, fileSize uint32,
+	blockSize uint32) {
 	packetBuffer := make([]byte, 512)
 	packetBuffer[0] = 'G'
 	packetBuffer[1] = byte(len(fileName))
@@ -122,8 +127,9 @@ func blockFetcher(fetchBlockChan chan uint32, udpConnection *snet.Conn, fileName
 	}
 }
 
-func blockReceiver(receivedBlockChan chan uint32, udpConnection *snet.Conn, fileBuffer []byte, fileSize uint32) {
-	packetBuffer := make([]byte, 2500)
+func blockReceiver(receivedBlockChan chan uint32, udpConnection *snet.Conn, fileBuffer []byte, fileSize uint32,
+	blockSize uint32) {
+	packetBuffer := make([]byte, blockHeaderLen+blockSize)
 	for {
 		n, _, err := udpConnection.ReadFrom(packetBuffer)
 		if err != nil {
@@ -151,13 +157,13 @@ func blockReceiver(receivedBlockChan chan uint32, udpConnection *snet.Conn, file
 			// Final block, read remaining amount
 			readLength = fileSize - startByte
 		}
-		if uint32(n) != 9+readLength {
+		if uint32(n) != blockHeaderLen+readLength {
 			continue
 		}
 		if endByte != startByte+readLength {
 			continue
 		}
-		copy(fileBuffer[startByte:], packetBuffer[9:n])
+		copy(fileBuffer[startByte:], packetBuffer[blockHeaderLen:n])
 		receivedBlockChan <- startByte
 	}
 }
@@ -169,10 +175,29 @@ func main() {
 	outputFilePath := flag.String("output", "", "Path to the output file")
 	flag.Parse()
 
-	udpConnection, err := appnet.Dial(*serverAddrStr)
+	serverAddr, err := appnet.ResolveUDPAddr(*serverAddrStr)
+	check(err)
+	paths, err := appnet.QueryPaths(serverAddr.IA)
+	check(err)
+	var path snet.Path // nil within the local AS
+	if len(paths) > 0 {
+		path = paths[0]
+		appnet.SetPath(serverAddr, path)
+	}
+	udpConnection, err := appnet.DialAddr(serverAddr)
 	check(err)
 
-	fileName, fileSize, rttApprox, err := fetchFileInfo(udpConnection)
+	// request blocks that fit into a single packet on the path
+	packetSize := appnet.MaxPayloadSize(path)
+	if packetSize <= blockHeaderLen {
+		log.Fatalf("MTU of the path to %s is too small", serverAddr)
+	}
+	blockSize := maxBlockSize
+	if uint32(packetSize-blockHeaderLen) < blockSize {
+		blockSize = uint32(packetSize - blockHeaderLen)
+	}
+
+	fileName, fileSize, rttApprox, err := fetchFileInfo(udpConnection, packetSize)
 	check(err)
 
 	fetchBlockChan := make(chan uint32, 2)
@@ -181,12 +206,12 @@ func main() {
 	fileBuffer := make([]byte, fileSize)
 
 	// Sends block fetch requests to image server
-	go blockFetcher(fetchBlockChan, udpConnection, fileName, fileSize)
+	go blockFetcher(fetchBlockChan, udpConnection, fileName, fileSize, blockSize)
 
 	// Receives arriving image blocks
 	// Instead of implementation as a goroutine, it can also be implemented as socket read with a timeout.
 	// In this approach, the control loop structure is quite clean.
-	go blockReceiver(receivedBlockChan, udpConnection, fileBuffer, fileSize)
+	go blockReceiver(receivedBlockChan, udpConnection, fileBuffer, fileSize, blockSize)
 
 	// The list of already requested blocks for which no response has yet been received.
 	// This is a map because the most common operation is insert and remove.
@@ -129,8 +129,8 @@ func main() {
 
 	go handleImageFiles(*dir, *keepFiles)
 
-	receivePacketBuffer := make([]byte, 2500)
-	sendPacketBuffer := make([]byte, 2500)
+	receivePacketBuffer := make([]byte, appnet.LocalMTU)
+	sendPacketBuffer := make([]byte, appnet.LocalMTU)
 	for {
 		// Handle client requests
 		n, remoteUDPaddress, err := udpConnection.ReadFrom(receivePacketBuffer)
@@ -178,7 +178,10 @@ func main() {
 					}
 					startByte := binary.LittleEndian.Uint32(receivePacketBuffer[filenameLen+2:])
 					endByte := binary.LittleEndian.Uint32(receivePacketBuffer[filenameLen+6:])
-					if endByte > startByte && endByte <= v.size+1 {
+					// the client chooses the block size to fit the MTU of
+					// the path; blocks must fit into the send buffer
+					if endByte > startByte && endByte <= v.size+1 &&
+						int(endByte-startByte) <= len(sendPacketBuffer)-9 {
 						sendPacketBuffer[0] = 'G'
 						// Copy startByte and endByte from request packet
 						copy(sendPacketBuffer[1:], receivePacketBuffer[filenameLen+2:filenameLen+10])
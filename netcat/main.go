@@ -25,6 +25,7 @@ import (
 	"sync"
 
 	"github.com/netsec-ethz/scion-apps/netcat/modes"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	scionlog "github.com/scionproto/scion/go/lib/log"
 
 	log "github.com/inconshreveable/log15"
@@ -43,6 +44,8 @@ var (
 
 	verboseMode     bool
 	veryVerboseMode bool
+
+	pathConf = pathselection.DefaultConfig()
 )
 
 func printUsage() {
@@ -63,6 +66,8 @@ func printUsage() {
 	fmt.Println("  -b: Send or expect an extra (throw-away) byte before the actual data")
 	fmt.Println("  -v: Enable verbose mode")
 	fmt.Println("  -vv: Enable very verbose mode")
+	fmt.Printf("  -%s: %s\n", pathselection.FlagSelect, pathselection.SelectUsage())
+	fmt.Printf("  -%s: %s\n", pathselection.FlagPolicy, pathselection.PolicyUsage())
 }
 
 func main() {
@@ -76,6 +81,7 @@ func main() {
 	flag.StringVar(&commandString, "c", "", "Command")
 	flag.BoolVar(&verboseMode, "v", false, "Verbose mode")
 	flag.BoolVar(&veryVerboseMode, "vv", false, "Very verbose mode")
+	pathConf.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	if veryVerboseMode {
@@ -235,11 +241,15 @@ func pipeConn(conn io.ReadWriteCloser) {
 }
 
 func doDial(remoteAddr string) io.ReadWriteCloser {
+	selector, err := pathConf.NewSelector()
+	if err != nil {
+		golog.Panicf("Invalid path selection: %v", err)
+	}
 	var conn io.ReadWriteCloser
 	if udpMode {
-		conn = modes.DoDialUDP(remoteAddr)
+		conn = modes.DoDialUDP(remoteAddr, selector)
 	} else {
-		conn = modes.DoDialQUIC(remoteAddr)
+		conn = modes.DoDialQUIC(remoteAddr, selector)
 	}
 
 	if extraByte {
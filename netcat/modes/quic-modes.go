@@ -21,40 +21,15 @@ import (
 	golog "log"
 
 	"github.com/lucas-clemente/quic-go"
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
 	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 
 	log "github.com/inconshreveable/log15"
 )
 
 const nextProto = "netcat"
 
-type sessConn struct {
-	sess   quic.Session
-	stream quic.Stream
-}
-
-func (conn *sessConn) Read(b []byte) (n int, err error) {
-	return conn.stream.Read(b)
-}
-
-func (conn *sessConn) Write(b []byte) (n int, err error) {
-	return conn.stream.Write(b)
-}
-
-func (conn *sessConn) Close() error {
-	err := conn.stream.Close()
-	if err != nil {
-		return err
-	}
-
-	err = conn.sess.CloseWithError(quic.ErrorCode(0), "")
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // DoListenQUIC listens on a QUIC socket
 func DoListenQUIC(port uint16) chan io.ReadWriteCloser {
 	listener, err := appquic.ListenPort(
@@ -83,21 +58,27 @@ func DoListenQUIC(port uint16) chan io.ReadWriteCloser {
 				continue
 			}
 
-			log.Info("New QUIC connection")
+			log.Info("New QUIC connection", "remote", appnet.FormatAddr(sess.RemoteAddr()))
 
-			conns <- &sessConn{
-				sess:   sess,
-				stream: stream,
-			}
+			conns <- appquic.NewStreamConn(sess, stream)
 		}
 	}()
 
 	return conns
 }
 
-// DoDialQUIC dials with a QUIC socket
-func DoDialQUIC(remoteAddr string) io.ReadWriteCloser {
-	sess, err := appquic.Dial(
+// DoDialQUIC dials with a QUIC socket, using a path chosen by selector
+func DoDialQUIC(remoteAddr string, selector pathselection.Selector) io.ReadWriteCloser {
+	raddr, err := appnet.ResolveUDPAddr(remoteAddr)
+	if err != nil {
+		golog.Panicf("Can't resolve remote address %v: %v", remoteAddr, err)
+	}
+	err = appnet.SelectPath(raddr, selector)
+	if err != nil {
+		golog.Panicf("Can't select path to remote address %v: %v", remoteAddr, err)
+	}
+	sess, err := appquic.DialAddr(
+		raddr,
 		remoteAddr,
 		&tls.Config{
 			InsecureSkipVerify: true,
@@ -116,8 +97,5 @@ func DoDialQUIC(remoteAddr string) io.ReadWriteCloser {
 
 	log.Debug("Connected!")
 
-	return &sessConn{
-		sess:   sess,
-		stream: stream,
-	}
+	return appquic.NewStreamConn(sess, stream)
 }
@@ -19,6 +19,7 @@ import (
 	golog "log"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 
 	log "github.com/inconshreveable/log15"
 )
@@ -45,9 +46,17 @@ func (conn *udpListenConn) Close() error {
 	return conn.close()
 }
 
-// DoDialUDP dials with a UDP socket
-func DoDialUDP(remoteAddr string) io.ReadWriteCloser {
-	conn, err := appnet.Dial(remoteAddr)
+// DoDialUDP dials with a UDP socket, using a path chosen by selector
+func DoDialUDP(remoteAddr string, selector pathselection.Selector) io.ReadWriteCloser {
+	raddr, err := appnet.ResolveUDPAddr(remoteAddr)
+	if err != nil {
+		golog.Panicf("Can't resolve remote address %v: %v", remoteAddr, err)
+	}
+	err = appnet.SelectPath(raddr, selector)
+	if err != nil {
+		golog.Panicf("Can't select path to remote address %v: %v", remoteAddr, err)
+	}
+	conn, err := appnet.DialAddr(raddr)
 	if err != nil {
 		golog.Panicf("Can't dial remote address %v: %v", remoteAddr, err)
 	}
@@ -82,7 +91,7 @@ func DoListenUDP(port uint16) chan io.ReadWriteCloser {
 			nrespChan := readResponses[addrStr]
 			if !contained {
 				// create new UDP connection
-				log.Info("New UDP connection", "addr", addrStr)
+				log.Info("New UDP connection", "addr", appnet.FormatAddr(addr))
 				nbufChan = make(chan []byte)
 				nrespChan = make(chan int, 1)
 
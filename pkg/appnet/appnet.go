@@ -37,15 +37,17 @@ Wildcard IP Addresses
 
 snet does not currently support binding to wildcard addresses. This will hopefully be
 added soon-ish, but in the meantime, this package emulates this functionality.
-There is one restriction, that applies to hosts with multiple IP addresses in the AS:
-the behaviour will be that of binding to one specific local IP address, which means that
-the application will not be reachable using any of the other IP addresses.
-Traffic sent will always appear to originate from this specific IP address,
-even if that's not the correct route to a destination in the local AS.
-
-This restriction will very likely not cause any issues, as a fairly contrived
-network setup would be required. Also, sciond has a similar restriction (binds
-to one specific IP address).
+When listening on a wildcard address, the conn is registered at the dispatcher
+on each of the local IP addresses of this host (of the same IP family as the
+address used to reach the local AS) and packets from all of these are
+multiplexed.
+Replies to a remote always leave from the local address on which the most
+recent packet from this remote arrived. Traffic to other destinations
+originates from the IP address used to reach the next hop.
+The LocalAddr of such a conn reports the default local IP address.
+
+When dialing, the conn is bound to one specific local IP address, determined
+by the next hop towards the destination.
 */
 package appnet
 
@@ -59,6 +61,7 @@ import (
 	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/sciond"
 	"github.com/scionproto/scion/go/lib/slayers"
 	"github.com/scionproto/scion/go/lib/snet"
@@ -69,20 +72,28 @@ import (
 // Network extends the snet.Network interface by making the local IA and common
 // sciond connections public.
 // The default singleton instance of this type is obtained by the DefNetwork
-// function.
+// function. Additional, independent instances, e.g. for different local ASes,
+// are created with NewNetwork.
 type Network struct {
 	snet.Network
 	IA            addr.IA
 	PathQuerier   snet.PathQuerier
 	hostInLocalAS net.IP
+	dispatcher    reliable.Dispatcher
+	sciondConn    sciond.Connector
+	pathCache     *pathCache
+	pmtu          *pmtuTable
+	scmpHandler   snet.SCMPHandler
+	// wildcard is the network used to listen on wildcard addresses
+	wildcard snet.Network
 }
 
 const (
 	initTimeout = 1 * time.Second
 )
 
-var defNetwork Network
-var initOnce sync.Once
+var defNetwork *Network
+var defNetworkMutex sync.Mutex
 
 type SCMPErrorHandler interface {
 	Handle(err *SCMPError)
@@ -96,19 +107,70 @@ var sciondAddr string
 // Typically, this will not be needed for applications directly, as they can
 // use the simplified Dial/Listen functions provided here.
 func DefNetwork() *Network {
-	initOnce.Do(mustInitDefNetwork)
-	return &defNetwork
+	defNetworkMutex.Lock()
+	defer defNetworkMutex.Unlock()
+	if defNetwork == nil {
+		mustInitDefNetwork()
+	}
+	return defNetwork
+}
+
+// defNetworkContext returns the default Network, analogous to DefNetwork.
+// The context bounds the initialization, if this has not succeeded before.
+// Unlike DefNetwork, initialization errors are returned.
+func defNetworkContext(ctx context.Context) (*Network, error) {
+	defNetworkMutex.Lock()
+	defer defNetworkMutex.Unlock()
+	if defNetwork == nil {
+		if err := initDefNetwork(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return defNetwork, nil
+}
+
+// SetDefNetwork replaces the default Network used by the package level
+// functions, e.g. with a Network created by NewCustomNetwork for testing.
+// It must be called before any other function of this package is used.
+func SetDefNetwork(n *Network) {
+	defNetworkMutex.Lock()
+	defer defNetworkMutex.Unlock()
+	defNetwork = n
 }
 
 // Dial connects to the address (on the SCION/UDP network).
 // The address can be of the form of a SCION address (i.e. of the form "ISD-AS,[IP]:port")
 // or in the form of hostname:port.
 func Dial(address string) (*snet.Conn, error) {
-	raddr, err := ResolveUDPAddr(address)
+	return DialContext(context.Background(), address)
+}
+
+// DialContext connects to the address (on the SCION/UDP network), analogous
+// to Dial.
+// The context bounds the name resolution, path lookup and registration at
+// the dispatcher; once the conn is established, it has no effect on the conn.
+func DialContext(ctx context.Context, address string) (*snet.Conn, error) {
+	n, err := defNetworkContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return DialAddr(raddr)
+	return n.DialContext(ctx, address)
+}
+
+// DialUDP connects to the address (on the SCION/UDP network) in this network.
+// See the package level Dial.
+func (n *Network) DialUDP(address string) (*snet.Conn, error) {
+	return n.DialContext(context.Background(), address)
+}
+
+// DialContext connects to the address (on the SCION/UDP network) in this
+// network. See the package level DialContext.
+func (n *Network) DialContext(ctx context.Context, address string) (*snet.Conn, error) {
+	raddr, err := ResolveUDPAddrContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return n.DialAddrContext(ctx, raddr)
 }
 
 // DialAddr connects to the address (on the SCION/UDP network).
@@ -116,21 +178,49 @@ func Dial(address string) (*snet.Conn, error) {
 // If no path is specified in raddr, DialAddr will choose the first available path.
 // This path is never updated during the lifetime of the conn. This does not
 // support long lived connections well, as the path *will* expire.
-// This is all that snet currently provides, we'll need to add a layer on top
-// that updates the paths in case they expire or are revoked.
+// Use DialAddrManaged for a conn that updates the path in case it expires or
+// is reported down.
 func DialAddr(raddr *snet.UDPAddr) (*snet.Conn, error) {
+	return DialAddrContext(context.Background(), raddr)
+}
+
+// DialAddrContext connects to the address (on the SCION/UDP network),
+// analogous to DialAddr.
+// The context bounds the path lookup and registration at the dispatcher.
+func DialAddrContext(ctx context.Context, raddr *snet.UDPAddr) (*snet.Conn, error) {
+	n, err := defNetworkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return n.DialAddrContext(ctx, raddr)
+}
+
+// DialAddr connects to the address (on the SCION/UDP network) in this
+// network. See the package level DialAddr.
+func (n *Network) DialAddr(raddr *snet.UDPAddr) (*snet.Conn, error) {
+	return n.DialAddrContext(context.Background(), raddr)
+}
+
+// DialAddrContext connects to the address (on the SCION/UDP network) in this
+// network. See the package level DialAddrContext.
+func (n *Network) DialAddrContext(ctx context.Context, raddr *snet.UDPAddr) (*snet.Conn, error) {
+	return n.dialAddr(ctx, raddr, n.Network)
+}
+
+// dialAddr connects to raddr, creating the conn in network.
+func (n *Network) dialAddr(ctx context.Context, raddr *snet.UDPAddr, network snet.Network) (*snet.Conn, error) {
 	if raddr.Path.IsEmpty() {
-		err := SetDefaultPath(raddr)
+		err := n.setDefaultPath(ctx, raddr)
 		if err != nil {
 			return nil, err
 		}
 	}
-	localIP, err := resolveLocal(raddr)
+	localIP, err := n.resolveLocal(raddr)
 	if err != nil {
 		return nil, err
 	}
 	laddr := &net.UDPAddr{IP: localIP}
-	return DefNetwork().Dial(context.Background(), "udp", laddr, raddr, addr.SvcNone)
+	return network.Dial(ctx, "udp", laddr, raddr, addr.SvcNone)
 }
 
 // Listen acts like net.ListenUDP in a SCION network.
@@ -139,22 +229,53 @@ func DialAddr(raddr *snet.UDPAddr) (*snet.Conn, error) {
 //
 // See note on wildcard addresses in the package documentation.
 func Listen(listen *net.UDPAddr) (*snet.Conn, error) {
+	return ListenContext(context.Background(), listen)
+}
+
+// ListenContext acts like net.ListenUDP in a SCION network, analogous to
+// Listen.
+// The context bounds the registration at the dispatcher.
+func ListenContext(ctx context.Context, listen *net.UDPAddr) (*snet.Conn, error) {
+	n, err := defNetworkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return n.ListenContext(ctx, listen)
+}
+
+// ListenUDP acts like net.ListenUDP in this network. See the package level
+// Listen.
+func (n *Network) ListenUDP(listen *net.UDPAddr) (*snet.Conn, error) {
+	return n.ListenContext(context.Background(), listen)
+}
+
+// ListenContext acts like net.ListenUDP in this network. See the package
+// level ListenContext.
+func (n *Network) ListenContext(ctx context.Context, listen *net.UDPAddr) (*snet.Conn, error) {
+	return n.listen(ctx, listen, n.Network, n.wildcard)
+}
+
+// listen creates the conn in network, or in wildcard if the listen address
+// is a wildcard address.
+func (n *Network) listen(ctx context.Context, listen *net.UDPAddr,
+	network, wildcard snet.Network) (*snet.Conn, error) {
+
 	if listen == nil {
 		listen = &net.UDPAddr{}
 	}
 	if listen.IP == nil || listen.IP.IsUnspecified() {
-		localIP, err := defaultLocalIP()
+		localIP, err := n.DefaultLocalIP()
 		if err != nil {
 			return nil, err
 		}
 		listen = &net.UDPAddr{IP: localIP, Port: listen.Port, Zone: listen.Zone}
+		network = wildcard
 	}
-	defNetwork := DefNetwork()
 	integrationEnv, _ := os.LookupEnv("SCION_GO_INTEGRATION")
 	if integrationEnv == "1" || integrationEnv == "true" || integrationEnv == "TRUE" {
-		fmt.Printf("Listening ia=:%v\n", defNetwork.IA)
+		fmt.Printf("Listening ia=:%v\n", n.IA)
 	}
-	return defNetwork.Listen(context.Background(), "udp", listen, addr.SvcNone)
+	return network.Listen(ctx, "udp", listen, addr.SvcNone)
 }
 
 // ListenPort is a shortcut to Listen on a specific port with a wildcard IP address.
@@ -213,25 +334,27 @@ func check(e error) {
 // The purpose of this function is to workaround not being able to bind to
 // wildcard addresses in snet.
 // See note on wildcard addresses in the package documentation.
-func resolveLocal(raddr *snet.UDPAddr) (net.IP, error) {
+func (n *Network) resolveLocal(raddr *snet.UDPAddr) (net.IP, error) {
 	if raddr.NextHop != nil {
 		nextHop := raddr.NextHop.IP
 		return addrutil.ResolveLocal(nextHop)
 	}
-	return defaultLocalIP()
+	return n.DefaultLocalIP()
 }
 
-// defaultLocalIP returns _a_ IP of this host in the local AS.
+// DefaultLocalIP returns _a_ IP of this host in the local AS, i.e. the IP used
+// to reach the local AS. Conns listening on a wildcard address report this
+// address as LocalAddr.
 //
 // The purpose of this function is to workaround not being able to bind to
 // wildcard addresses in snet.
 // See note on wildcard addresses in the package documentation.
-func defaultLocalIP() (net.IP, error) {
-	return addrutil.ResolveLocal(DefNetwork().hostInLocalAS)
+func (n *Network) DefaultLocalIP() (net.IP, error) {
+	return addrutil.ResolveLocal(n.hostInLocalAS)
 }
 
 func mustInitDefNetwork() {
-	err := initDefNetwork()
+	err := initDefNetwork(context.Background())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing SCION network: %v\n", err)
 		os.Exit(1)
@@ -240,6 +363,8 @@ func mustInitDefNetwork() {
 
 type sCMPHandler struct {
 	nextHandler snet.SCMPHandler
+	pathCache   *pathCache
+	pmtu        *pmtuTable
 }
 
 type SCMPInterfaceInfo struct {
@@ -266,6 +391,33 @@ func (h sCMPHandler) Handle(pkt *snet.Packet) error {
 		return errors.New("scmp handler invoked with non-scmp packet")
 	}
 	typeCode := slayers.CreateSCMPTypeCode(scmp.Type(), scmp.Code())
+
+	// Drop cached paths over the broken interface and let ManagedConns fail
+	// over to paths avoiding it.
+	var downIfaces []ifaceKey
+	switch msg := pkt.Payload.(type) {
+	case snet.SCMPExternalInterfaceDown:
+		downIfaces = []ifaceKey{{msg.IA, common.IFIDType(msg.Interface)}}
+	case snet.SCMPInternalConnectivityDown:
+		downIfaces = []ifaceKey{
+			{msg.IA, common.IFIDType(msg.Ingress)},
+			{msg.IA, common.IFIDType(msg.Egress)},
+		}
+	}
+	if len(downIfaces) > 0 {
+		if h.pathCache != nil {
+			h.pathCache.ifaceDown(downIfaces)
+		}
+		notifyIfaceDown(downIfaces...)
+	}
+	// Remember the smaller MTU of the path, see PathMTU.
+	if msg, ok := pkt.Payload.(snet.SCMPPacketTooBig); ok && h.pmtu != nil {
+		if ev, ok := newSCMPEvent(pkt); ok {
+			h.pmtu.learn(ev.Path, msg.MTU)
+			notifyPathMTU()
+		}
+	}
+
 	// if !typeCode.InfoMsg() {
 	// 	metrics.M.SCMPErrors().Inc()
 	// }
@@ -296,50 +448,125 @@ func (h sCMPHandler) Handle(pkt *snet.Packet) error {
 	return nil
 }
 
-func initDefNetwork() error {
-	ctx, cancel := context.WithTimeout(context.Background(), initTimeout)
+// initDefNetwork initializes the default Network. The initialization is
+// bounded by ctx and initTimeout.
+func initDefNetwork(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, initTimeout)
 	defer cancel()
-	dispatcher, err := findDispatcher()
+	n, err := NewNetwork(ctx, sciondAddr, dispSocket)
 	if err != nil {
 		return err
 	}
-	sciondConn, err := findSciond(ctx)
+	defNetwork = n
+	return nil
+}
+
+// NewNetwork creates a Network for the local AS of the sciond at
+// sciondAddress, using the dispatcher at dispatcherSocket.
+// The returned Network is independent of the default Network returned by
+// DefNetwork and of the SetSciondAddress and SetDispatcherSocket settings.
+// The context bounds the connection setup to sciond.
+func NewNetwork(ctx context.Context, sciondAddress, dispatcherSocket string) (*Network, error) {
+	dispatcher, err := findDispatcher(dispatcherSocket)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sciondConn, err := findSciond(ctx, sciondAddress)
+	if err != nil {
+		return nil, err
 	}
 	localIA, err := sciondConn.LocalIA(ctx)
 	if err != nil {
-		return err
+		sciondConn.Close(ctx)
+		return nil, err
 	}
 	hostInLocalAS, err := findAnyHostInLocalAS(ctx, sciondConn)
 	if err != nil {
-		return err
+		sciondConn.Close(ctx)
+		return nil, err
 	}
 	pathQuerier := sciond.Querier{Connector: sciondConn, IA: localIA}
+	revHandler := sciond.RevHandler{Connector: sciondConn}
+	n := newNetwork(localIA, pathQuerier, dispatcher, revHandler, hostInLocalAS)
+	n.sciondConn = sciondConn
+	return n, nil
+}
+
+// NewCustomNetwork creates a Network for the local AS ia from its
+// components, instead of connecting to sciond and the dispatcher at their
+// default locations.
+// hostInLocalAS is the IP address of any host in the local AS, used to
+// determine the local IP address. This is mainly useful to run applications
+// on a fake network in tests, see package appnettest.
+func NewCustomNetwork(ia addr.IA, pathQuerier snet.PathQuerier,
+	dispatcher reliable.Dispatcher, hostInLocalAS net.IP) *Network {
+
+	return newNetwork(ia, pathQuerier, dispatcher, nil, hostInLocalAS)
+}
 
-	n := &snet.SCIONNetwork{
-		LocalIA: localIA,
-		Dispatcher: &snet.DefaultPacketDispatcherService{
-			Dispatcher: dispatcher,
-			SCMPHandler: &sCMPHandler {
-				&snet.DefaultSCMPHandler{
-					RevocationHandler: sciond.RevHandler{Connector: sciondConn},
-				},
+func newNetwork(ia addr.IA, pathQuerier snet.PathQuerier, dispatcher reliable.Dispatcher,
+	revHandler snet.RevocationHandler, hostInLocalAS net.IP) *Network {
+
+	cache := newPathCache(pathQuerier)
+	pmtu := newPMTUTable()
+	n := &Network{
+		IA:            ia,
+		PathQuerier:   pathQuerier,
+		hostInLocalAS: hostInLocalAS,
+		dispatcher:    dispatcher,
+		pathCache:     cache,
+		pmtu:          pmtu,
+		scmpHandler: &sCMPHandler{
+			nextHandler: &snet.DefaultSCMPHandler{
+				RevocationHandler: revHandler,
 			},
+			pathCache: cache,
+			pmtu:      pmtu,
 		},
 	}
+	n.Network, n.wildcard = n.networks(n.scmpHandler)
+	return n
+}
 
-	defNetwork = Network{Network: n, IA: localIA, PathQuerier: pathQuerier, hostInLocalAS: hostInLocalAS}
-	return nil
+// networks returns the snet.Networks for conns bound to a specific address
+// and for conns bound to a wildcard address, processing SCMP messages with
+// scmpHandler.
+func (n *Network) networks(scmpHandler snet.SCMPHandler) (snet.Network, snet.Network) {
+	dispatcherService := &snet.DefaultPacketDispatcherService{
+		Dispatcher:  n.dispatcher,
+		SCMPHandler: scmpHandler,
+	}
+	network := &snet.SCIONNetwork{
+		LocalIA:    n.IA,
+		Dispatcher: dispatcherService,
+	}
+	wildcard := &snet.SCIONNetwork{
+		LocalIA: n.IA,
+		Dispatcher: &wildcardDispatcherService{
+			PacketDispatcherService: dispatcherService,
+			localIPs:                n.localIPs,
+		},
+	}
+	return network, wildcard
+}
+
+// Close stops the background path refreshes and closes the sciond
+// connection of the Network, if any.
+// Conns created from the Network are not affected.
+func (n *Network) Close() error {
+	n.pathCache.close()
+	if n.sciondConn == nil {
+		return nil
+	}
+	return n.sciondConn.Close(context.Background())
 }
 
-func findSciond(ctx context.Context) (sciond.Connector, error) {
+func findSciond(ctx context.Context, address string) (sciond.Connector, error) {
 // Reading the environment is broken with this API on iOS
 //	address, ok := os.LookupEnv("SCION_DAEMON_ADDRESS")
 //	if !ok {
 //		address = sciond.DefaultAPIAddress
 //	}
-    address := sciondAddr
 	sciondConn, err := sciond.NewService(address).Connect(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to SCIOND at %s (override with SCION_DAEMON_ADDRESS): %w", address, err)
@@ -347,8 +574,8 @@ func findSciond(ctx context.Context) (sciond.Connector, error) {
 	return sciondConn, nil
 }
 
-func findDispatcher() (reliable.Dispatcher, error) {
-	path, err := findDispatcherSocket()
+func findDispatcher(socket string) (reliable.Dispatcher, error) {
+	path, err := findDispatcherSocket(socket)
 	if err != nil {
 		return nil, err
 	}
@@ -356,6 +583,9 @@ func findDispatcher() (reliable.Dispatcher, error) {
 	return dispatcher, nil
 }
 
+// SetSCMPErrorHandler installs a process-wide handler for all SCMP errors.
+// To react to SCMP errors per conn, use the events of an SCMPConn instead,
+// see ListenSCMP and DialAddrSCMP.
 func SetSCMPErrorHandler(handler SCMPErrorHandler) {
     scmpErrorHandler = handler
 }
@@ -368,13 +598,12 @@ func SetSciondAddress(addr string) {
     sciondAddr = addr
 }
 
-func findDispatcherSocket() (string, error) {
+func findDispatcherSocket(path string) (string, error) {
 // Reading the environment is broken with this API on iOS
 //	path, ok := os.LookupEnv("SCION_DISPATCHER_SOCKET")
 //	if !ok {
 //		path = reliable.DefaultDispPath
 //	}
-    path := dispSocket
 	err := statSocket(path)
 	if err != nil {
 		return "", fmt.Errorf("error looking for SCION dispatcher socket at %s (override with SCION_DISPATCHER_SOCKET): %w", path, err)
@@ -0,0 +1,81 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+)
+
+// TestDefNetworkContext checks that the initialization of the default Network
+// is bounded by the caller's context, and not only by initTimeout.
+func TestDefNetworkContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	disp, err := net.Listen("unix", filepath.Join(dir, "dispatcher.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disp.Close()
+	// a sciond that accepts connections but never answers
+	sciond, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sciond.Close()
+	go func() {
+		for {
+			conn, err := sciond.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	oldNetwork, oldSciond, oldDisp := defNetwork, sciondAddr, dispSocket
+	defer func() {
+		SetDefNetwork(oldNetwork)
+		SetSciondAddress(oldSciond)
+		SetDispatcherSocket(oldDisp)
+	}()
+	SetDefNetwork(nil)
+	SetSciondAddress(sciond.Addr().String())
+	SetDispatcherSocket(disp.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = QueryPathsContext(ctx, addr.IA{I: 1, A: 0xff0000000111})
+	if err == nil {
+		t.Fatal("expected error, sciond does not answer")
+	}
+	if elapsed := time.Since(start); elapsed >= initTimeout {
+		t.Errorf("expected initialization to be aborted with the context, took %v", elapsed)
+	}
+	if defNetwork != nil {
+		t.Error("expected default Network to remain uninitialized after failure")
+	}
+}
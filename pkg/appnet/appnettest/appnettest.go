@@ -0,0 +1,270 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package appnettest provides an in-process fake SCION network, to unit test
+applications built on appnet and appquic without a running SCION topology.
+
+A Topology consists of ASes connected by links. Paths between ASes are
+computed from the links and handed out by a fake path querier in place of
+sciond. Packets are forwarded by an in-memory switch in place of the
+dispatcher and border routers; the switch follows the path in each packet
+and drops packets with invalid paths.
+
+Each link can be configured with a latency, a loss rate and an MTU, and can
+be set down. Packets too large for a link and packets over a link that is
+down are answered with the corresponding SCMP errors, as are packets to
+ports without a listening conn. SCMP echo requests are answered for every
+host with a listening conn.
+
+Typical use in a test:
+
+	topo := appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia2, 2).SetLatency(10 * time.Millisecond)
+	topo.SetDefault(ia1)          // the code under test runs in ia1
+	server := topo.Network(ia2)   // a peer in ia2
+	conn, err := server.ListenContext(ctx, &net.UDPAddr{Port: 1234})
+
+All hosts in the fake network have the IP address 127.0.0.1.
+*/
+package appnettest
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+)
+
+const (
+	// DefaultMTU is the MTU of links for which no MTU is set.
+	DefaultMTU = 1472
+	// PathLifetime is the time after which paths returned by the fake path
+	// querier expire.
+	PathLifetime = 6 * time.Hour
+	// maxPathLinks limits the length of the paths computed by the topology.
+	maxPathLinks = 8
+)
+
+var (
+	// HostIP is the IP address of all hosts in the fake network.
+	HostIP = net.IPv4(127, 0, 0, 1)
+	// routerAddr is the underlay address reported as next and last hop for
+	// all inter-AS traffic.
+	routerAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 30042}
+)
+
+// Topology is a fake SCION network of ASes connected by links.
+// All methods are safe for concurrent use.
+type Topology struct {
+	mutex    sync.RWMutex
+	links    []*Link
+	conns    map[connKey]*packetConn
+	nextPort uint16
+
+	randMutex sync.Mutex
+	rand      *rand.Rand
+}
+
+// NewTopology returns an empty topology. ASes are added implicitly by
+// AddLink or Network.
+func NewTopology() *Topology {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &Topology{
+		conns: make(map[connKey]*packetConn),
+		// Start at a random port, so that topologies in the same process do
+		// not hand out the same local addresses; quic-go keeps conns in a
+		// process-wide table indexed by the local address.
+		nextPort: minEphemeralPort + uint16(r.Intn(1<<16-minEphemeralPort)),
+		rand:     r,
+	}
+}
+
+// Link is a link between two ASes of a Topology.
+type Link struct {
+	topo      *Topology
+	a, b      linkEnd
+	latency   time.Duration
+	loss      float64
+	mtu       uint16
+	bandwidth uint64
+	down      bool
+}
+
+type linkEnd struct {
+	ia   addr.IA
+	ifid common.IFIDType
+}
+
+// AddLink connects interface aIf of AS a with interface bIf of AS b.
+// The returned Link can be used to configure the link properties.
+func (t *Topology) AddLink(a addr.IA, aIf common.IFIDType, b addr.IA, bIf common.IFIDType) *Link {
+	l := &Link{
+		topo: t,
+		a:    linkEnd{a, aIf},
+		b:    linkEnd{b, bIf},
+		mtu:  DefaultMTU,
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.links = append(t.links, l)
+	return l
+}
+
+// SetLatency sets the one-way latency of the link.
+func (l *Link) SetLatency(latency time.Duration) *Link {
+	l.topo.mutex.Lock()
+	defer l.topo.mutex.Unlock()
+	l.latency = latency
+	return l
+}
+
+// SetLoss sets the fraction of packets, in [0,1], dropped on the link.
+func (l *Link) SetLoss(loss float64) *Link {
+	l.topo.mutex.Lock()
+	defer l.topo.mutex.Unlock()
+	l.loss = loss
+	return l
+}
+
+// SetMTU sets the MTU of the link. Larger packets are answered with an SCMP
+// packet too big error.
+func (l *Link) SetMTU(mtu uint16) *Link {
+	l.topo.mutex.Lock()
+	defer l.topo.mutex.Unlock()
+	l.mtu = mtu
+	return l
+}
+
+// SetBandwidth sets the bandwidth of the link in Kbit/s. This is only
+// reported in the path metadata; the traffic is not shaped.
+func (l *Link) SetBandwidth(bandwidth uint64) *Link {
+	l.topo.mutex.Lock()
+	defer l.topo.mutex.Unlock()
+	l.bandwidth = bandwidth
+	return l
+}
+
+// SetDown sets the link down or up again. Packets over a link that is down
+// are answered with an SCMP external interface down error.
+// Paths over the link are still returned by the path querier, like sciond
+// does until the interface is revoked.
+func (l *Link) SetDown(down bool) *Link {
+	l.topo.mutex.Lock()
+	defer l.topo.mutex.Unlock()
+	l.down = down
+	return l
+}
+
+// other returns the end of the link opposite to the interface ifid of ia,
+// or false if the link is not attached to this interface.
+func (l *Link) other(ia addr.IA, ifid common.IFIDType) (linkEnd, bool) {
+	switch {
+	case l.a.ia == ia && l.a.ifid == ifid:
+		return l.b, true
+	case l.b.ia == ia && l.b.ifid == ifid:
+		return l.a, true
+	}
+	return linkEnd{}, false
+}
+
+// linkAt returns the link attached to interface ifid of ia.
+// The caller must hold the mutex.
+func (t *Topology) linkAt(ia addr.IA, ifid common.IFIDType) *Link {
+	for _, l := range t.links {
+		if _, ok := l.other(ia, ifid); ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// Network returns an appnet.Network for the AS ia in this topology.
+func (t *Topology) Network(ia addr.IA) *appnet.Network {
+	return appnet.NewCustomNetwork(ia, pathQuerier{t, ia}, dispatcher{t}, HostIP)
+}
+
+// SetDefault installs the Network for the AS ia as the default appnet
+// Network, used by the package level functions of appnet and appquic.
+// It must be called before these are used.
+func (t *Topology) SetDefault(ia addr.IA) *appnet.Network {
+	n := t.Network(ia)
+	appnet.SetDefNetwork(n)
+	return n
+}
+
+// Paths returns all loop-free paths from src to dst with up to 8 links,
+// shortest first.
+// Returns nil if src equals dst.
+func (t *Topology) Paths(src, dst addr.IA) []snet.Path {
+	if src == dst {
+		return nil
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var routes [][]traversal
+	visited := map[addr.IA]bool{src: true}
+	var walk func(cur addr.IA, route []traversal)
+	walk = func(cur addr.IA, route []traversal) {
+		if cur == dst {
+			routes = append(routes, append([]traversal(nil), route...))
+			return
+		}
+		if len(route) == maxPathLinks {
+			return
+		}
+		for _, l := range t.links {
+			for _, from := range []linkEnd{l.a, l.b} {
+				if from.ia != cur {
+					continue
+				}
+				to, _ := l.other(from.ia, from.ifid)
+				if visited[to.ia] {
+					continue
+				}
+				visited[to.ia] = true
+				walk(to.ia, append(route, traversal{from: from, to: to, link: l}))
+				visited[to.ia] = false
+			}
+		}
+	}
+	walk(src, nil)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i]) < len(routes[j]) })
+
+	paths := make([]snet.Path, len(routes))
+	for i, r := range routes {
+		paths[i] = newPath(dst, r)
+	}
+	return paths
+}
+
+// pathQuerier is a snet.PathQuerier returning the paths of the topology.
+type pathQuerier struct {
+	topo *Topology
+	src  addr.IA
+}
+
+func (q pathQuerier) Query(_ context.Context, dst addr.IA) ([]snet.Path, error) {
+	return q.topo.Paths(q.src, dst), nil
+}
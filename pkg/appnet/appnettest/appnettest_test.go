@@ -0,0 +1,132 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnettest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+)
+
+var (
+	ia1 = addr.IA{I: 1, A: 0xff0000000111}
+	ia2 = addr.IA{I: 1, A: 0xff0000000112}
+	ia3 = addr.IA{I: 1, A: 0xff0000000113}
+)
+
+func TestPaths(t *testing.T) {
+	topo := NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia3, 1).SetMTU(1400)
+	topo.AddLink(ia3, 2, ia2, 2)
+
+	paths := topo.Paths(ia1, ia2)
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 paths, got %d", len(paths))
+	}
+	if n := len(paths[0].Metadata().Interfaces); n != 2 {
+		t.Errorf("expected direct path first, got %d interfaces", n)
+	}
+	if n := len(paths[1].Metadata().Interfaces); n != 4 {
+		t.Errorf("expected path via %s second, got %d interfaces", ia3, n)
+	}
+	if mtu := paths[1].Metadata().MTU; mtu != 1400 {
+		t.Errorf("expected MTU 1400, got %d", mtu)
+	}
+	if paths := topo.Paths(ia1, ia1); paths != nil {
+		t.Errorf("expected no paths within AS, got %v", paths)
+	}
+}
+
+func TestSendOverAllPaths(t *testing.T) {
+	topo := NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2).SetLatency(5 * time.Millisecond)
+
+	ctx := context.Background()
+	server, err := topo.Network(ia2).ListenContext(ctx, &net.UDPAddr{IP: HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	client := topo.Network(ia1)
+	for _, path := range topo.Paths(ia1, ia2) {
+		raddr := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: HostIP, Port: 1234}}
+		appnet.SetPath(raddr, path)
+		conn, err := client.DialAddrContext(ctx, raddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 16)
+		_ = server.SetReadDeadline(time.Now().Add(time.Second))
+		n, from, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "ping" {
+			t.Errorf("expected ping, got %q", buf[:n])
+		}
+		if _, err := server.WriteTo([]byte("pong"), from); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err = conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "pong" {
+			t.Errorf("expected pong, got %q", buf[:n])
+		}
+		conn.Close()
+	}
+}
+
+func TestLoss(t *testing.T) {
+	topo := NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1).SetLoss(1)
+
+	ctx := context.Background()
+	server, err := topo.Network(ia2).ListenContext(ctx, &net.UDPAddr{IP: HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	raddr := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: HostIP, Port: 1234}}
+	appnet.SetPath(raddr, topo.Paths(ia1, ia2)[0])
+	conn, err := topo.Network(ia1).DialAddrContext(ctx, raddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := server.ReadFrom(make([]byte, 16)); err == nil {
+		t.Error("expected timeout, but packet was delivered over lossy link")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnettest
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/slayers/path"
+	"github.com/scionproto/scion/go/lib/slayers/path/scion"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+// traversal is the crossing of a link from one AS to the next.
+type traversal struct {
+	from, to linkEnd
+	link     *Link
+}
+
+// hop is the passage of a packet through an AS, in the direction of travel.
+type hop struct {
+	ingress, egress common.IFIDType
+}
+
+// newPath creates the path over the route to dst.
+// The caller must hold the mutex of the topology.
+func newPath(dst addr.IA, route []traversal) snet.Path {
+	hops := make([]hop, len(route)+1)
+	meta := snet.PathMetadata{
+		MTU:    DefaultMTU,
+		Expiry: time.Now().Add(PathLifetime),
+	}
+	for i, t := range route {
+		hops[i].egress = t.from.ifid
+		hops[i+1].ingress = t.to.ifid
+		meta.Interfaces = append(meta.Interfaces,
+			snet.PathInterface{IA: t.from.ia, ID: t.from.ifid},
+			snet.PathInterface{IA: t.to.ia, ID: t.to.ifid},
+		)
+		if i > 0 { // within the AS, between the previous link and this one
+			meta.Latency = append(meta.Latency, 0)
+			meta.Bandwidth = append(meta.Bandwidth, 0)
+		}
+		meta.Latency = append(meta.Latency, t.link.latency)
+		meta.Bandwidth = append(meta.Bandwidth, t.link.bandwidth)
+		if t.link.mtu < meta.MTU {
+			meta.MTU = t.link.mtu
+		}
+	}
+	return &snetpath.Path{
+		Dst:     dst,
+		SPath:   spath.Path{Raw: encodeHops(hops), Type: scion.PathType},
+		NextHop: routerAddr,
+		Meta:    meta,
+	}
+}
+
+// encodeHops encodes the hops as a SCION path with a single segment in
+// construction direction.
+// See the SCION header specification for the layout.
+func encodeHops(hops []hop) []byte {
+	const (
+		metaLen = 4
+		infoLen = 8
+	)
+	b := make([]byte, metaLen+infoLen+len(hops)*path.HopLen)
+	// PathMetaHdr: CurrINF=0, CurrHF=0, Seg0Len=len(hops)
+	binary.BigEndian.PutUint32(b, uint32(len(hops))<<12)
+	// InfoField: ConsDir flag set
+	info := b[metaLen:]
+	info[0] = 0x01
+	binary.BigEndian.PutUint32(info[4:], uint32(time.Now().Unix()))
+	for i, h := range hops {
+		hf := b[metaLen+infoLen+i*path.HopLen:]
+		hf[1] = 63 // ExpTime, maximum lifetime of the hop field
+		binary.BigEndian.PutUint16(hf[2:], uint16(h.ingress))
+		binary.BigEndian.PutUint16(hf[4:], uint16(h.egress))
+	}
+	return b
+}
+
+// decodeHops returns the hops of the path in the direction of travel.
+func decodeHops(p spath.Path) ([]hop, error) {
+	if p.Type != scion.PathType {
+		return nil, errors.New("unsupported path type")
+	}
+	var decoded scion.Decoded
+	if err := decoded.DecodeFromBytes(p.Raw); err != nil {
+		return nil, err
+	}
+	hops := make([]hop, 0, decoded.NumHops)
+	hfIdx := 0
+	for i := 0; i < decoded.NumINF; i++ {
+		consDir := decoded.InfoFields[i].ConsDir
+		segLen := int(decoded.PathMeta.SegLen[i])
+		for j := 0; j < segLen; j++ {
+			hf := decoded.HopFields[hfIdx+j]
+			h := hop{
+				ingress: common.IFIDType(hf.ConsIngress),
+				egress:  common.IFIDType(hf.ConsEgress),
+			}
+			if !consDir {
+				h.ingress, h.egress = h.egress, h.ingress
+			}
+			hops = append(hops, h)
+		}
+		hfIdx += segLen
+	}
+	return hops, nil
+}
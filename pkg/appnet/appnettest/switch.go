@@ -0,0 +1,392 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnettest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+const (
+	// endhostPort is the underlay port of end hosts, reported as last hop for
+	// traffic within an AS.
+	endhostPort      = 30041
+	minEphemeralPort = 32768
+	// queueSize is the number of packets buffered per conn; further packets
+	// are dropped.
+	queueSize = 256
+	// maxQuoteLen is the maximum length of the offending packet quoted in
+	// SCMP errors.
+	maxQuoteLen = 1024
+)
+
+type connKey struct {
+	ia   addr.IA
+	ip   string
+	port uint16
+}
+
+// dispatcher is a reliable.Dispatcher registering conns at the switch of
+// the topology.
+type dispatcher struct {
+	topo *Topology
+}
+
+func (d dispatcher) Register(ctx context.Context, ia addr.IA, address *net.UDPAddr,
+	svc addr.HostSVC) (net.PacketConn, uint16, error) {
+
+	if svc != addr.SvcNone {
+		return nil, 0, fmt.Errorf("appnettest: registering SVC address %s not supported", svc)
+	}
+	if address == nil || address.IP == nil {
+		return nil, 0, fmt.Errorf("appnettest: registration requires an IP address")
+	}
+	return d.topo.register(ia, address)
+}
+
+func (t *Topology) register(ia addr.IA, address *net.UDPAddr) (*packetConn, uint16, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	port := uint16(address.Port)
+	if port == 0 {
+		for i := 0; ; i++ {
+			if i > 1<<16-minEphemeralPort {
+				return nil, 0, fmt.Errorf("appnettest: no free port for %s,%s", ia, address.IP)
+			}
+			port = t.nextPort
+			t.nextPort++
+			if t.nextPort == 0 {
+				t.nextPort = minEphemeralPort
+			}
+			if _, used := t.conns[connKey{ia, address.IP.String(), port}]; !used {
+				break
+			}
+		}
+	}
+	key := connKey{ia, address.IP.String(), port}
+	if _, used := t.conns[key]; used {
+		return nil, 0, fmt.Errorf("appnettest: port %d already in use at %s,%s", port, ia, address.IP)
+	}
+	c := &packetConn{
+		topo:            t,
+		key:             key,
+		local:           &net.UDPAddr{IP: address.IP, Port: int(port), Zone: address.Zone},
+		queue:           make(chan datagram, queueSize),
+		closed:          make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+	t.conns[key] = c
+	return c, port, nil
+}
+
+func (t *Topology) unregister(c *packetConn) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.conns[c.key] == c {
+		delete(t.conns, c.key)
+	}
+}
+
+// send forwards the raw SCION packet sent by conn from along its path. The
+// packet is copied, as the sender may reuse its buffer.
+func (t *Topology) send(from *packetConn, raw []byte) {
+	pkt := &snet.Packet{Bytes: append(snet.Bytes(nil), raw...)}
+	if err := pkt.Decode(); err != nil {
+		return // not a valid SCION packet, drop
+	}
+	srcIA := from.key.ia
+	dstIA := pkt.Destination.IA
+	lastHop := &net.UDPAddr{IP: from.local.IP, Port: endhostPort}
+	if srcIA != dstIA {
+		lastHop = routerAddr
+	}
+
+	t.mutex.RLock()
+	latency, delivered, failure := t.route(srcIA, dstIA, pkt.Path, len(raw))
+	t.mutex.RUnlock()
+	if failure != nil {
+		t.sendSCMP(from, pkt, raw, failure.ia, latency, failure.msg)
+		return
+	}
+	if !delivered {
+		return
+	}
+
+	dstIP := pkt.Destination.Host.IP()
+	switch payload := pkt.Payload.(type) {
+	case snet.UDPPayload:
+		t.mutex.RLock()
+		to := t.conns[connKey{dstIA, dstIP.String(), payload.DstPort}]
+		t.mutex.RUnlock()
+		if to == nil {
+			t.sendSCMP(from, pkt, raw, dstIA, latency,
+				snet.SCMPDestinationUnreachable{Payload: quote(raw)})
+			return
+		}
+		to.deliver(pkt.Bytes, lastHop, latency)
+	case snet.SCMPEchoRequest:
+		if !t.hasHost(dstIA, dstIP) {
+			return
+		}
+		reply := snet.SCMPEchoReply{
+			Identifier: payload.Identifier,
+			SeqNumber:  payload.SeqNumber,
+			Payload:    payload.Payload,
+		}
+		t.sendSCMP(from, pkt, raw, dstIA, 2*latency, reply)
+	}
+}
+
+// routeFailure is an SCMP error raised by the AS ia while forwarding a packet.
+type routeFailure struct {
+	ia  addr.IA
+	msg snet.Payload
+}
+
+// route follows the path from src to dst, returning the accumulated latency
+// and whether the packet survived the link losses.
+// The caller must hold the mutex for reading.
+func (t *Topology) route(src, dst addr.IA, p spath.Path, size int) (time.Duration, bool, *routeFailure) {
+	if src == dst {
+		return 0, p.IsEmpty(), nil
+	}
+	hops, err := decodeHops(p)
+	if err != nil || len(hops) < 2 {
+		return 0, false, nil
+	}
+	var latency time.Duration
+	cur := src
+	for i, h := range hops[:len(hops)-1] {
+		l := t.linkAt(cur, h.egress)
+		if l == nil {
+			return latency, false, nil
+		}
+		if l.down {
+			return latency, false, &routeFailure{cur, snet.SCMPExternalInterfaceDown{
+				IA:        cur,
+				Interface: uint64(h.egress),
+			}}
+		}
+		if size > int(l.mtu) {
+			return latency, false, &routeFailure{cur, snet.SCMPPacketTooBig{MTU: l.mtu}}
+		}
+		next, _ := l.other(cur, h.egress)
+		if hops[i+1].ingress != next.ifid {
+			return latency, false, nil
+		}
+		latency += l.latency
+		if l.loss > 0 && t.randFloat() < l.loss {
+			return latency, false, nil
+		}
+		cur = next.ia
+	}
+	last := hops[len(hops)-1]
+	return latency, cur == dst && last.egress == 0, nil
+}
+
+func (t *Topology) randFloat() float64 {
+	t.randMutex.Lock()
+	defer t.randMutex.Unlock()
+	return t.rand.Float64()
+}
+
+func (t *Topology) hasHost(ia addr.IA, ip net.IP) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for k := range t.conns {
+		if k.ia == ia && k.ip == ip.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// sendSCMP sends the SCMP message from the AS ia back to the sender of pkt,
+// over the reversed path of pkt.
+func (t *Topology) sendSCMP(to *packetConn, pkt *snet.Packet, raw []byte, ia addr.IA,
+	latency time.Duration, msg snet.Payload) {
+
+	switch m := msg.(type) {
+	case snet.SCMPExternalInterfaceDown:
+		m.Payload = quote(raw)
+		msg = m
+	case snet.SCMPPacketTooBig:
+		m.Payload = quote(raw)
+		msg = m
+	}
+	replyPath := pkt.Path.Copy()
+	if err := replyPath.Reverse(); err != nil {
+		return
+	}
+	srcHost := addr.HostFromIP(routerAddr.IP)
+	if ia == pkt.Destination.IA {
+		srcHost = pkt.Destination.Host
+	}
+	reply := &snet.Packet{
+		Bytes: make(snet.Bytes, common.MaxMTU),
+		PacketInfo: snet.PacketInfo{
+			Source:      snet.SCIONAddress{IA: ia, Host: srcHost},
+			Destination: pkt.Source,
+			Path:        replyPath,
+			Payload:     msg,
+		},
+	}
+	if err := reply.Serialize(); err != nil {
+		return
+	}
+	lastHop := routerAddr
+	if ia == to.key.ia {
+		lastHop = &net.UDPAddr{IP: to.local.IP, Port: endhostPort}
+	}
+	to.deliver(reply.Bytes, lastHop, latency)
+}
+
+// quote returns the beginning of the offending packet, to be included in SCMP
+// error messages.
+func quote(raw []byte) []byte {
+	if len(raw) > maxQuoteLen {
+		raw = raw[:maxQuoteLen]
+	}
+	return append([]byte(nil), raw...)
+}
+
+type datagram struct {
+	b       []byte
+	lastHop *net.UDPAddr
+}
+
+// packetConn is the net.PacketConn of a registration at the fake dispatcher.
+type packetConn struct {
+	topo  *Topology
+	key   connKey
+	local *net.UDPAddr
+	queue chan datagram
+
+	mutex           sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// deliver queues the packet after the given latency, dropping it if the
+// queue is full.
+func (c *packetConn) deliver(b []byte, lastHop *net.UDPAddr, latency time.Duration) {
+	d := datagram{b: b, lastHop: lastHop}
+	enqueue := func() {
+		select {
+		case <-c.closed:
+		case c.queue <- d:
+		default:
+		}
+	}
+	if latency > 0 {
+		time.AfterFunc(latency, enqueue)
+	} else {
+		enqueue()
+	}
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mutex.Lock()
+		deadline := c.readDeadline
+		deadlineChanged := c.deadlineChanged
+		c.mutex.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		n, lastHop, done, err := c.readOnce(b, timeout, deadlineChanged)
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return n, lastHop, err
+		}
+	}
+}
+
+// readOnce waits for a packet until the timeout, the deadline is changed or
+// the conn is closed. done is false if the read needs to be retried with the
+// new deadline.
+func (c *packetConn) readOnce(b []byte, timeout <-chan time.Time,
+	deadlineChanged <-chan struct{}) (n int, lastHop net.Addr, done bool, err error) {
+
+	select {
+	case d := <-c.queue:
+		return copy(b, d.b), d.lastHop, true, nil
+	case <-timeout:
+		return 0, nil, true, &net.OpError{Op: "read", Net: "udp", Addr: c.local, Err: os.ErrDeadlineExceeded}
+	case <-deadlineChanged:
+		return 0, nil, false, nil
+	case <-c.closed:
+		return 0, nil, true, net.ErrClosed
+	}
+}
+
+func (c *packetConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.topo.send(c, b)
+	return len(b), nil
+}
+
+func (c *packetConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *packetConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *packetConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline is a no-op, writes never block.
+func (c *packetConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *packetConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.topo.unregister(c)
+	})
+	return nil
+}
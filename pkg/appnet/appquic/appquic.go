@@ -18,16 +18,32 @@
 package appquic
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"sync"
 
 	"github.com/lucas-clemente/quic-go"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
+// PacketSize is the size of the UDP payload of the QUIC packets sent over
+// SCION. quic-go uses its minimum packet size for addresses that are not
+// *net.UDPAddr, so paths must carry at least this payload.
+//
+// The quic-go version used here derives the packet size only from the type of
+// the remote address and offers no configuration to adapt it to the path MTU.
+// Instead, the packet size is fixed and the paths are chosen to fit it: Dial
+// and its variants only use paths whose MTU allows QUIC packets of this size,
+// and the conns of DialAddrMigrating and DialAddrMultipath move away from a
+// path whose MTU, as reported by SCMP packet too big messages, has become
+// too small (see appnet.PathMTU).
+const PacketSize = 1200
+
 var (
 	srvTLSDummyCerts     []tls.Certificate
 	srvTLSDummyCertsInit sync.Once
@@ -39,7 +55,7 @@ var (
 // the close-the-socket behaviour of quic.DialAddr.
 type closerSession struct {
 	quic.Session
-	conn *snet.Conn
+	conn net.PacketConn
 }
 
 func (s *closerSession) CloseWithError(code quic.ErrorCode, desc string) error {
@@ -50,7 +66,7 @@ func (s *closerSession) CloseWithError(code quic.ErrorCode, desc string) error {
 // closerEarlySession is a wrapper around quic.EarlySession, analogous to closerSession
 type closerEarlySession struct {
 	quic.EarlySession
-	conn *snet.Conn
+	conn net.PacketConn
 }
 
 func (s *closerEarlySession) CloseWithError(code quic.ErrorCode, desc string) error {
@@ -62,11 +78,18 @@ func (s *closerEarlySession) CloseWithError(code quic.ErrorCode, desc string) er
 // The address can be of the form of a SCION address (i.e. of the form "ISD-AS,[IP]:port")
 // or in the form of hostname:port.
 func Dial(remote string, tlsConf *tls.Config, quicConf *quic.Config) (quic.Session, error) {
-	raddr, err := appnet.ResolveUDPAddr(remote)
+	return DialContext(context.Background(), remote, tlsConf, quicConf)
+}
+
+// DialContext establishes a new QUIC connection to a server at the remote
+// address, analogous to Dial.
+// The context bounds the name resolution, path lookup and QUIC handshake.
+func DialContext(ctx context.Context, remote string, tlsConf *tls.Config, quicConf *quic.Config) (quic.Session, error) {
+	raddr, err := appnet.ResolveUDPAddrContext(ctx, remote)
 	if err != nil {
 		return nil, err
 	}
-	return DialAddr(raddr, remote, tlsConf, quicConf)
+	return DialAddrContext(ctx, raddr, remote, tlsConf, quicConf)
 }
 
 // DialAddr establishes a new QUIC connection to a server at the remote address.
@@ -76,17 +99,27 @@ func Dial(remote string, tlsConf *tls.Config, quicConf *quic.Config) (quic.Sessi
 // The host parameter is used for SNI.
 // The tls.Config must define an application protocol (using NextProtos).
 func DialAddr(raddr *snet.UDPAddr, host string, tlsConf *tls.Config, quicConf *quic.Config) (quic.Session, error) {
-	err := ensurePathDefined(raddr)
+	return DialAddrContext(context.Background(), raddr, host, tlsConf, quicConf)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server at the
+// remote address, analogous to DialAddr.
+// The context bounds the path lookup and QUIC handshake.
+func DialAddrContext(ctx context.Context, raddr *snet.UDPAddr, host string,
+	tlsConf *tls.Config, quicConf *quic.Config) (quic.Session, error) {
+
+	err := ensurePathDefined(ctx, raddr)
 	if err != nil {
 		return nil, err
 	}
-	sconn, err := appnet.Listen(nil)
+	sconn, err := appnet.ListenContext(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	host = appnet.MangleSCIONAddr(host)
-	session, err := quic.Dial(sconn, raddr, host, tlsConf, quicConf)
+	session, err := quic.DialContext(ctx, sconn, raddr, host, tlsConf, quicConf)
 	if err != nil {
+		sconn.Close()
 		return nil, err
 	}
 	return &closerSession{session, sconn}, nil
@@ -94,40 +127,86 @@ func DialAddr(raddr *snet.UDPAddr, host string, tlsConf *tls.Config, quicConf *q
 
 // DialEarly establishes a new 0-RTT QUIC connection to a server. Analogous to Dial.
 func DialEarly(remote string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
-	raddr, err := appnet.ResolveUDPAddr(remote)
+	return DialEarlyContext(context.Background(), remote, tlsConf, quicConf)
+}
+
+// DialEarlyContext establishes a new 0-RTT QUIC connection to a server.
+// Analogous to DialContext.
+func DialEarlyContext(ctx context.Context, remote string, tlsConf *tls.Config,
+	quicConf *quic.Config) (quic.EarlySession, error) {
+
+	raddr, err := appnet.ResolveUDPAddrContext(ctx, remote)
 	if err != nil {
 		return nil, err
 	}
-	return DialAddrEarly(raddr, remote, tlsConf, quicConf)
+	return DialAddrEarlyContext(ctx, raddr, remote, tlsConf, quicConf)
 }
 
 // DialAddrEarly establishes a new 0-RTT QUIC connection to a server. Analogous to DialAddr.
 func DialAddrEarly(raddr *snet.UDPAddr, host string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
-	err := ensurePathDefined(raddr)
+	return DialAddrEarlyContext(context.Background(), raddr, host, tlsConf, quicConf)
+}
+
+// DialAddrEarlyContext establishes a new 0-RTT QUIC connection to a server.
+// Analogous to DialAddrContext.
+func DialAddrEarlyContext(ctx context.Context, raddr *snet.UDPAddr, host string,
+	tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+
+	err := ensurePathDefined(ctx, raddr)
 	if err != nil {
 		return nil, err
 	}
-	sconn, err := appnet.Listen(nil)
+	sconn, err := appnet.ListenContext(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	host = appnet.MangleSCIONAddr(host)
-	session, err := quic.DialEarly(sconn, raddr, host, tlsConf, quicConf)
+	session, err := quic.DialEarlyContext(ctx, sconn, raddr, host, tlsConf, quicConf)
 	if err != nil {
+		sconn.Close()
 		return nil, err
 	}
 	// XXX(matzf): quic.DialEarly seems to have the wrong return type declared (quic.DialAddrEarly returns EarlySession)
 	return &closerEarlySession{session.(quic.EarlySession), sconn}, nil
 }
 
-func ensurePathDefined(raddr *snet.UDPAddr) error {
+// ensurePathDefined sets the first path that can carry QUIC packets of
+// PacketSize, if raddr does not already specify a path.
+func ensurePathDefined(ctx context.Context, raddr *snet.UDPAddr) error {
 	if raddr.Path.IsEmpty() {
-		return appnet.SetDefaultPath(raddr)
+		paths, err := appnet.QueryPathsContext(ctx, raddr.IA)
+		if err != nil || len(paths) == 0 {
+			return err
+		}
+		paths = filterPathsForQUIC(appnet.DefNetwork(), paths)
+		if len(paths) == 0 {
+			return errNoPathForQUIC(raddr.IA)
+		}
+		appnet.SetPath(raddr, paths[0])
 	}
 	return nil
 }
 
+// filterPathsForQUIC returns the paths with an MTU in the network n sufficient
+// for QUIC packets of PacketSize.
+func filterPathsForQUIC(n *appnet.Network, paths []snet.Path) []snet.Path {
+	var usable []snet.Path
+	for _, p := range paths {
+		if n.MaxPayloadSize(p) >= PacketSize {
+			usable = append(usable, p)
+		}
+	}
+	return usable
+}
+
+func errNoPathForQUIC(ia addr.IA) error {
+	return fmt.Errorf("no path to %s with MTU sufficient for QUIC packets", ia)
+}
+
 // ListenPort listens for QUIC connections on a SCION/UDP port.
+// Replies to each client are sent over the reverse of the path of the most
+// recent packet received from it, so that sessions follow clients migrating
+// to different paths (see DialAddrMigrating).
 //
 // See note on wildcard addresses in the appnet package documentation.
 func ListenPort(port uint16, tlsConf *tls.Config, quicConfig *quic.Config) (quic.Listener, error) {
@@ -135,7 +214,7 @@ func ListenPort(port uint16, tlsConf *tls.Config, quicConfig *quic.Config) (quic
 	if err != nil {
 		return nil, err
 	}
-	return quic.Listen(sconn, tlsConf, quicConfig)
+	return quic.Listen(NewReplyPathConn(sconn), tlsConf, quicConfig)
 }
 
 // GetDummyTLSCert returns the singleton TLS certificate with a fresh
@@ -0,0 +1,162 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+)
+
+const (
+	// migrationSilenceTimeout is the time after which a path is considered
+	// failed if no packets are received from the server while sending.
+	migrationSilenceTimeout = 3 * time.Second
+	// replyPathIdleTimeout is the time after which reply paths of remotes that
+	// have not sent any packets are forgotten.
+	replyPathIdleTimeout = 5 * time.Minute
+)
+
+// MigrationHandler is called whenever a session is migrated to a new path.
+type MigrationHandler func(old, new snet.Path)
+
+// DialMigrating establishes a new QUIC connection to a server at the remote
+// address, that is migrated to another path if the current path fails.
+// Analogous to Dial.
+func DialMigrating(remote string, tlsConf *tls.Config, quicConf *quic.Config,
+	onMigrate MigrationHandler) (quic.Session, error) {
+
+	raddr, err := appnet.ResolveUDPAddr(remote)
+	if err != nil {
+		return nil, err
+	}
+	return DialAddrMigrating(raddr, remote, tlsConf, quicConf, onMigrate)
+}
+
+// DialAddrMigrating establishes a new QUIC connection to a server at the
+// remote address, analogous to DialAddr.
+//
+// The session is transparently migrated to another path when the current path
+// fails, i.e. when an SCMP interface down message is received for the path or
+// when no packets (e.g. acknowledgements) have been received from the server
+// for a while. The path is also refreshed before it expires, see
+// appnet.ManagedConn. Any path set in raddr is ignored; only paths with an
+// MTU sufficient for QUIC packets are used.
+// onMigrate, if not nil, is called for every migration.
+func DialAddrMigrating(raddr *snet.UDPAddr, host string, tlsConf *tls.Config, quicConf *quic.Config,
+	onMigrate MigrationHandler) (quic.Session, error) {
+
+	mconn, err := appnet.DialAddrManaged(raddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := mconn.SetMinPayloadSize(PacketSize); err != nil {
+		mconn.Close()
+		return nil, err
+	}
+	mconn.SetFailoverOnSilence(migrationSilenceTimeout)
+	if onMigrate != nil {
+		mconn.SetPathChangeHandler(onMigrate)
+	}
+	host = appnet.MangleSCIONAddr(host)
+	session, err := quic.Dial(mconn, mconn.RemoteAddr(), host, tlsConf, quicConf)
+	if err != nil {
+		mconn.Close()
+		return nil, err
+	}
+	return &closerSession{session, mconn}, nil
+}
+
+// ReplyPathConn is a wrapper around snet.Conn that replies to each remote over
+// the reverse of the path on which the most recent packet from this remote
+// was received.
+// quic-go sends all packets of a session to the address from which the first
+// packet was received. With this wrapper, the server follows the client when
+// it migrates to a different path.
+type ReplyPathConn struct {
+	*snet.Conn
+	mutex     sync.Mutex
+	paths     map[string]replyPath
+	lastPurge time.Time
+}
+
+type replyPath struct {
+	addr     *snet.UDPAddr
+	lastSeen time.Time
+}
+
+// NewReplyPathConn wraps conn to reply over the most recent path of each
+// remote. This is used by ListenPort; use it to serve QUIC on a custom conn.
+func NewReplyPathConn(conn *snet.Conn) *ReplyPathConn {
+	return &ReplyPathConn{
+		Conn:  conn,
+		paths: make(map[string]replyPath),
+	}
+}
+
+func (c *ReplyPathConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, from, err := c.Conn.ReadFrom(b)
+	if a, ok := from.(*snet.UDPAddr); ok && err == nil {
+		now := time.Now()
+		c.mutex.Lock()
+		c.paths[hostKey(a)] = replyPath{addr: a.Copy(), lastSeen: now}
+		if now.Sub(c.lastPurge) > replyPathIdleTimeout {
+			for k, p := range c.paths {
+				if now.Sub(p.lastSeen) > replyPathIdleTimeout {
+					delete(c.paths, k)
+				}
+			}
+			c.lastPurge = now
+		}
+		c.mutex.Unlock()
+	}
+	return n, from, err
+}
+
+func (c *ReplyPathConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if a, ok := addr.(*snet.UDPAddr); ok {
+		c.mutex.Lock()
+		p, ok := c.paths[hostKey(a)]
+		c.mutex.Unlock()
+		if ok {
+			addr = p.addr
+		}
+	}
+	return c.Conn.WriteTo(b, addr)
+}
+
+// LastAddr returns the address, including the reply path, of the most recent
+// packet received from the host and port of remote, or nil if none was
+// received recently.
+func (c *ReplyPathConn) LastAddr(remote *snet.UDPAddr) *snet.UDPAddr {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	p, ok := c.paths[hostKey(remote)]
+	if !ok {
+		return nil
+	}
+	return p.addr.Copy()
+}
+
+// hostKey identifies the remote host and port, ignoring the path.
+func hostKey(a *snet.UDPAddr) string {
+	return a.IA.String() + "," + a.Host.String()
+}
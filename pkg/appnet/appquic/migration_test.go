@@ -0,0 +1,302 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+)
+
+var (
+	ia1 = addr.IA{I: 1, A: 0xff0000000111}
+	ia2 = addr.IA{I: 1, A: 0xff0000000112}
+	ia3 = addr.IA{I: 1, A: 0xff0000000113}
+	ia4 = addr.IA{I: 1, A: 0xff0000000114}
+)
+
+func TestFailoverOnSilence(t *testing.T) {
+	topo := appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2)
+	topo.AddLink(ia1, 3, ia4, 1)
+	topo.AddLink(ia4, 2, ia2, 3)
+	topo.SetDefault(ia1)
+
+	// the server never replies
+	server, err := topo.Network(ia2).ListenContext(context.Background(),
+		&net.UDPAddr{IP: appnettest.HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	raddr := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: 1234}}
+	conn, err := appnet.DialAddrManaged(raddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	changes := make(chan snet.Path, 10)
+	conn.SetPathChangeHandler(func(old, new snet.Path) { changes <- new })
+	conn.SetFailoverOnSilence(100 * time.Millisecond)
+
+	if _, err := conn.Write([]byte("unanswered")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected failover to another path after silence")
+	}
+	// without further writes, the new path must not be considered failed
+	select {
+	case p := <-changes:
+		t.Errorf("unexpected second failover without sending, to %v", p)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestMigrationReplyPath(t *testing.T) {
+	topo := appnettest.NewTopology()
+	direct := topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2)
+	topo.SetDefault(ia1)
+
+	sconn, err := topo.Network(ia2).ListenContext(context.Background(),
+		&net.UDPAddr{IP: appnettest.HostIP, Port: 1235})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// quic-go does not close conns passed to Listen. It only forgets them
+	// some time after they are closed, so other tests use different ports.
+	defer sconn.Close()
+	listener, err := quic.Listen(NewReplyPathConn(sconn),
+		&tls.Config{Certificates: GetDummyTLSCerts(), NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		session, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		stream, err := session.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(stream, stream)
+	}()
+
+	migrations := make(chan snet.Path, 10)
+	raddr := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: 1235}}
+	session, err := DialAddrMigrating(raddr, "server",
+		&tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}, nil,
+		func(old, new snet.Path) { migrations <- new })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseWithError(0, "")
+	stream, err := session.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(msg string) {
+		if _, err := stream.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("no echo of %q: %v", msg, err)
+		}
+	}
+	echo("before")
+
+	direct.SetDown(true)
+	// the server only reaches the client if it replies over the new path
+	echo("after")
+	select {
+	case p := <-migrations:
+		if n := len(p.Metadata().Interfaces); n != 4 {
+			t.Errorf("expected migration to the path via %s, got %v", ia3, p)
+		}
+	default:
+		t.Error("expected migration after the link went down")
+	}
+}
+
+// TestMigrationPathMTU checks that a migrating session moves to another path
+// when an SCMP packet too big message shows that the MTU of the current path
+// has become too small for QUIC packets.
+func TestMigrationPathMTU(t *testing.T) {
+	topo := appnettest.NewTopology()
+	direct := topo.AddLink(ia1, 1, ia2, 1)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2)
+	topo.SetDefault(ia1)
+
+	sconn, err := topo.Network(ia2).ListenContext(context.Background(),
+		&net.UDPAddr{IP: appnettest.HostIP, Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sconn.Close()
+	listener, err := quic.Listen(NewReplyPathConn(sconn),
+		&tls.Config{Certificates: GetDummyTLSCerts(), NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		session, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		stream, err := session.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(stream, stream)
+	}()
+
+	migrations := make(chan snet.Path, 10)
+	raddr := &snet.UDPAddr{IA: ia2, Host: sconn.LocalAddr().(*net.UDPAddr)}
+	session, err := DialAddrMigrating(raddr, "server",
+		&tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}, nil,
+		func(old, new snet.Path) { migrations <- new })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseWithError(0, "")
+	stream, err := session.OpenStreamSync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(msg []byte) {
+		if _, err := stream.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("no echo of %d bytes: %v", len(msg), err)
+		}
+	}
+	echo([]byte("before"))
+
+	// the path metadata still reports the old MTU; only full-sized packets
+	// trigger SCMP packet too big messages
+	direct.SetMTU(1000)
+	start := time.Now()
+	echo(make([]byte, 4*PacketSize))
+	select {
+	case p := <-migrations:
+		if n := len(p.Metadata().Interfaces); n != 4 {
+			t.Errorf("expected migration to the path via %s, got %v", ia3, p)
+		}
+	default:
+		t.Fatal("expected migration after the path MTU decreased")
+	}
+	if d := time.Since(start); d >= migrationSilenceTimeout {
+		t.Errorf("expected migration on packet too big before the silence timeout, took %v", d)
+	}
+}
+
+// TestDialPathMTU checks that paths with an MTU too small for QUIC packets are
+// not used, even if they are the shortest.
+func TestDialPathMTU(t *testing.T) {
+	topo := appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1).SetMTU(1000)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2)
+	topo.SetDefault(ia1)
+
+	sconn, err := topo.Network(ia2).ListenContext(context.Background(),
+		&net.UDPAddr{IP: appnettest.HostIP, Port: 1236})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sconn.Close()
+	listener, err := quic.Listen(NewReplyPathConn(sconn),
+		&tls.Config{Certificates: GetDummyTLSCerts(), NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			session, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream, err := session.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				_, _ = io.Copy(stream, stream)
+			}()
+		}
+	}()
+
+	echo := func(session quic.Session) {
+		stream, err := session.OpenStreamSync(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("no echo: %v", err)
+		}
+	}
+	raddr := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: 1236}}
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}
+
+	session, err := DialAddrMigrating(raddr, "server", tlsConf, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseWithError(0, "")
+	echo(session)
+
+	session, mpconn, err := DialAddrMultipath(raddr, "server", tlsConf, nil,
+		&MultipathConfig{NumPaths: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseWithError(0, "")
+	echo(session)
+	if stats := mpconn.Stats(); len(stats) != 1 || len(stats[0].Path.Metadata().Interfaces) != 4 {
+		t.Errorf("expected only the path via %s, got %v", ia3, stats)
+	}
+}
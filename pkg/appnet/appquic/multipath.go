@@ -0,0 +1,364 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
+)
+
+const (
+	defaultMultipathPaths = 2
+	defaultProbeInterval  = 1 * time.Second
+	// statsSmoothing is the weight of a new sample in the exponentially
+	// weighted moving averages of RTT and loss.
+	statsSmoothing = 0.125
+)
+
+// PathStats are the statistics of one of the paths of a MultipathConn.
+// RTT and Loss are measured with periodic SCMP echo probes.
+type PathStats struct {
+	Path snet.Path
+	// RTT is the smoothed round trip time, 0 if not yet measured.
+	RTT time.Duration
+	// Loss is the smoothed fraction of lost probes, in [0,1].
+	Loss        float64
+	PacketsSent uint64
+	BytesSent   uint64
+}
+
+// PathScheduler chooses the path for each packet sent by a MultipathConn.
+type PathScheduler interface {
+	// Next returns the index of the path to use for the next packet.
+	// stats contains the current statistics of all paths and must not be
+	// retained or modified.
+	Next(stats []PathStats) int
+}
+
+// roundRobinScheduler uses all paths in turn.
+type roundRobinScheduler struct {
+	next int
+}
+
+// RoundRobinScheduler returns a PathScheduler using all paths in turn.
+func RoundRobinScheduler() PathScheduler {
+	return &roundRobinScheduler{}
+}
+
+func (s *roundRobinScheduler) Next(stats []PathStats) int {
+	i := s.next % len(stats)
+	s.next = (i + 1) % len(stats)
+	return i
+}
+
+// lowestRTTScheduler uses the path with the lowest measured RTT.
+type lowestRTTScheduler struct{}
+
+// LowestRTTScheduler returns a PathScheduler using the path with the lowest
+// measured RTT. The first path is used until RTTs have been measured.
+func LowestRTTScheduler() PathScheduler {
+	return lowestRTTScheduler{}
+}
+
+func (lowestRTTScheduler) Next(stats []PathStats) int {
+	best := 0
+	for i, s := range stats {
+		if s.RTT > 0 && (stats[best].RTT == 0 || s.RTT < stats[best].RTT) {
+			best = i
+		}
+	}
+	return best
+}
+
+// lossWeightedScheduler picks a random path, weighted by the measured
+// delivery ratio.
+type lossWeightedScheduler struct {
+	rand *rand.Rand
+}
+
+// LossWeightedScheduler returns a PathScheduler choosing a random path for
+// each packet, weighted by the fraction of probes delivered over the path.
+func LossWeightedScheduler() PathScheduler {
+	return &lossWeightedScheduler{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (s *lossWeightedScheduler) Next(stats []PathStats) int {
+	const minWeight = 0.01 // keep sending occasionally over lossy paths
+	var total float64
+	for _, st := range stats {
+		total += lossWeight(st.Loss, minWeight)
+	}
+	r := s.rand.Float64() * total
+	for i, st := range stats {
+		r -= lossWeight(st.Loss, minWeight)
+		if r < 0 {
+			return i
+		}
+	}
+	return len(stats) - 1
+}
+
+func lossWeight(loss, minWeight float64) float64 {
+	if w := 1 - loss; w > minWeight {
+		return w
+	}
+	return minWeight
+}
+
+// MultipathConfig configures the paths and scheduling of a MultipathConn.
+type MultipathConfig struct {
+	// NumPaths is the maximum number of paths used. Defaults to 2.
+	NumPaths int
+	// Scheduler chooses the path for each packet. Defaults to RoundRobinScheduler.
+	Scheduler PathScheduler
+	// ProbeInterval is the interval between SCMP echo probes on each path.
+	// Defaults to 1s.
+	ProbeInterval time.Duration
+	// Network is the SCION network to dial on. Defaults to appnet.DefNetwork().
+	Network *appnet.Network
+}
+
+// MultipathConn is a net.PacketConn that distributes the packets sent to one
+// remote over multiple paths. Packets to any other address are passed to the
+// underlying conn unchanged.
+type MultipathConn struct {
+	*snet.Conn
+	n         *appnet.Network
+	remote    *snet.UDPAddr
+	scheduler PathScheduler
+	prober    *appnet.RTTProber
+
+	mutex   sync.Mutex
+	stats   []PathStats
+	remotes []*snet.UDPAddr // remote with the path of the corresponding stats entry
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMultipathConn creates a MultipathConn sending packets to remote over
+// paths, according to the scheduler. conn must belong to the network n.
+// The paths are probed from n in the background until the conn is closed.
+func NewMultipathConn(n *appnet.Network, conn *snet.Conn, remote *snet.UDPAddr, paths []snet.Path,
+	scheduler PathScheduler, probeInterval time.Duration) (*MultipathConn, error) {
+
+	c := &MultipathConn{
+		Conn:      conn,
+		n:         n,
+		remote:    remote.Copy(),
+		scheduler: scheduler,
+		stats:     make([]PathStats, len(paths)),
+		remotes:   make([]*snet.UDPAddr, len(paths)),
+		closed:    make(chan struct{}),
+	}
+	for i, p := range paths {
+		c.stats[i].Path = p
+		c.remotes[i] = remote.Copy()
+		appnet.SetPath(c.remotes[i], p)
+	}
+	if len(paths) > 0 {
+		prober, err := n.NewRTTProber(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		c.prober = prober
+		go c.probe(probeInterval)
+	}
+	return c, nil
+}
+
+// WriteTo sends the packet. If addr is the remote of this conn, the path is
+// chosen by the scheduler; if the path MTU of the chosen path has decreased
+// below the size of the packet, another path is used.
+func (c *MultipathConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	a, ok := addr.(*snet.UDPAddr)
+	if !ok || !c.isRemote(a) {
+		return c.Conn.WriteTo(b, addr)
+	}
+	c.mutex.Lock()
+	if len(c.stats) == 0 { // local IA, nothing to schedule
+		c.mutex.Unlock()
+		return c.Conn.WriteTo(b, addr)
+	}
+	i := c.scheduler.Next(c.stats)
+	if c.n.MaxPayloadSize(c.stats[i].Path) < len(b) {
+		i = c.fallbackPath(i, len(b))
+	}
+	c.stats[i].PacketsSent++
+	c.stats[i].BytesSent += uint64(len(b))
+	remote := c.remotes[i]
+	c.mutex.Unlock()
+	return c.Conn.WriteTo(b, remote)
+}
+
+// Stats returns a snapshot of the statistics of all paths.
+func (c *MultipathConn) Stats() []PathStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := make([]PathStats, len(c.stats))
+	copy(stats, c.stats)
+	return stats
+}
+
+// Close stops the probing and closes the underlying conn.
+func (c *MultipathConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.prober != nil {
+			c.prober.Close()
+		}
+	})
+	return c.Conn.Close()
+}
+
+// fallbackPath returns the first path that can carry a payload of the given
+// size according to the current path MTUs, or i if there is none.
+// The path MTU of a path decreases when an SCMP packet too big message is
+// received for it.
+func (c *MultipathConn) fallbackPath(i, size int) int {
+	for j := range c.stats {
+		if c.n.MaxPayloadSize(c.stats[j].Path) >= size {
+			return j
+		}
+	}
+	return i
+}
+
+func (c *MultipathConn) isRemote(a *snet.UDPAddr) bool {
+	return a.IA == c.remote.IA && a.Host.IP.Equal(c.remote.Host.IP) && a.Host.Port == c.remote.Host.Port
+}
+
+// probe periodically measures RTT and loss of all paths until the conn is closed.
+func (c *MultipathConn) probe(interval time.Duration) {
+	paths := make([]snet.Path, len(c.stats))
+	for i := range c.stats {
+		paths[i] = c.stats[i].Path
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+		rtts, err := c.prober.Probe(c.remote, paths, interval)
+		if err != nil {
+			continue
+		}
+		c.mutex.Lock()
+		for i, p := range paths {
+			s := &c.stats[i]
+			rtt, ok := rtts[snet.Fingerprint(p)]
+			lost := 1.0
+			if ok {
+				lost = 0
+				if s.RTT == 0 {
+					s.RTT = rtt
+				} else {
+					s.RTT += time.Duration(statsSmoothing * float64(rtt-s.RTT))
+				}
+			}
+			s.Loss += statsSmoothing * (lost - s.Loss)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// DialMultipath establishes a new QUIC connection to a server at the remote
+// address, sending over multiple paths. Analogous to Dial.
+func DialMultipath(remote string, tlsConf *tls.Config, quicConf *quic.Config,
+	mpConf *MultipathConfig) (quic.Session, *MultipathConn, error) {
+
+	raddr, err := appnet.ResolveUDPAddr(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DialAddrMultipath(raddr, remote, tlsConf, quicConf, mpConf)
+}
+
+// DialAddrMultipath establishes a new QUIC connection to a server at the
+// remote address, sending over up to mpConf.NumPaths paths, chosen to be as
+// disjoint as possible, among the paths with an MTU sufficient for QUIC
+// packets. Any path set in raddr is ignored.
+// The returned MultipathConn gives access to the per-path statistics; it is
+// closed together with the session.
+func DialAddrMultipath(raddr *snet.UDPAddr, host string, tlsConf *tls.Config, quicConf *quic.Config,
+	mpConf *MultipathConfig) (quic.Session, *MultipathConn, error) {
+
+	conf := MultipathConfig{}
+	if mpConf != nil {
+		conf = *mpConf
+	}
+	if conf.NumPaths <= 0 {
+		conf.NumPaths = defaultMultipathPaths
+	}
+	if conf.Scheduler == nil {
+		conf.Scheduler = RoundRobinScheduler()
+	}
+	if conf.ProbeInterval <= 0 {
+		conf.ProbeInterval = defaultProbeInterval
+	}
+	n := conf.Network
+	if n == nil {
+		n = appnet.DefNetwork()
+	}
+
+	paths, err := n.QueryPaths(raddr.IA)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(paths) > 0 {
+		paths = filterPathsForQUIC(n, paths)
+		if len(paths) == 0 {
+			return nil, nil, errNoPathForQUIC(raddr.IA)
+		}
+	}
+	paths = pathselection.Disjoint(paths, conf.NumPaths)
+	remote := raddr.Copy()
+	if len(paths) > 0 {
+		appnet.SetPath(remote, paths[0])
+	} else if remote.IA != n.IA {
+		return nil, nil, errors.New("no path available")
+	}
+
+	sconn, err := n.ListenUDP(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	mpconn, err := NewMultipathConn(n, sconn, remote, paths, conf.Scheduler, conf.ProbeInterval)
+	if err != nil {
+		sconn.Close()
+		return nil, nil, err
+	}
+	host = appnet.MangleSCIONAddr(host)
+	session, err := quic.Dial(mpconn, remote, host, tlsConf, quicConf)
+	if err != nil {
+		mpconn.Close()
+		return nil, nil, err
+	}
+	return &closerSession{session, mpconn}, mpconn, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+)
+
+func TestRoundRobinScheduler(t *testing.T) {
+	stats := make([]PathStats, 3)
+	s := RoundRobinScheduler()
+	for i := 0; i < 9; i++ {
+		if actual := s.Next(stats); actual != i%3 {
+			t.Fatalf("Round robin scheduler: expected path %d, got %d", i%3, actual)
+		}
+	}
+}
+
+func TestLowestRTTScheduler(t *testing.T) {
+	stats := make([]PathStats, 3)
+	s := LowestRTTScheduler()
+	if actual := s.Next(stats); actual != 0 {
+		t.Errorf("Lowest RTT scheduler without measurements: expected path 0, got %d", actual)
+	}
+	stats[0].RTT = 30 * time.Millisecond
+	stats[2].RTT = 10 * time.Millisecond
+	if actual := s.Next(stats); actual != 2 {
+		t.Errorf("Lowest RTT scheduler: expected path 2, got %d", actual)
+	}
+}
+
+func TestLossWeightedScheduler(t *testing.T) {
+	stats := make([]PathStats, 2)
+	stats[0].Loss = 1
+	s := LossWeightedScheduler()
+	counts := make([]int, len(stats))
+	for i := 0; i < 1000; i++ {
+		counts[s.Next(stats)]++
+	}
+	if counts[0] >= counts[1] {
+		t.Errorf("Loss weighted scheduler: lossy path used more often than loss-free path: %v", counts)
+	}
+}
+
+func TestDialAddrMultipath(t *testing.T) {
+	topo := appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1).SetLatency(20 * time.Millisecond)
+	topo.AddLink(ia1, 2, ia3, 1)
+	topo.AddLink(ia3, 2, ia2, 2)
+	// dial from ia1, which is not the default network
+	topo.SetDefault(ia2)
+
+	sconn, err := topo.Network(ia2).ListenContext(context.Background(),
+		&net.UDPAddr{IP: appnettest.HostIP, Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sconn.Close()
+	listener, err := quic.Listen(NewReplyPathConn(sconn),
+		&tls.Config{Certificates: GetDummyTLSCerts(), NextProtos: []string{"test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			session, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := session.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func() { _, _ = io.Copy(stream, stream) }()
+				}
+			}()
+		}
+	}()
+
+	raddr := &snet.UDPAddr{IA: ia2, Host: sconn.LocalAddr().(*net.UDPAddr)}
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}
+	session, mpconn, err := DialAddrMultipath(raddr, "server", tlsConf, nil,
+		&MultipathConfig{
+			NumPaths:      2,
+			ProbeInterval: 50 * time.Millisecond,
+			Network:       topo.Network(ia1),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.CloseWithError(0, "")
+
+	for i := 0; i < 5; i++ {
+		stream, err := session.OpenStreamSync(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte("hello")
+		if _, err := stream.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("no echo: %v", err)
+		}
+		stream.Close()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var stats []PathStats
+	for time.Now().Before(deadline) {
+		stats = mpconn.Stats()
+		if len(stats) == 2 && stats[0].RTT > 0 && stats[1].RTT > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 paths, got %v", stats)
+	}
+	for i, s := range stats {
+		if s.PacketsSent == 0 {
+			t.Errorf("no packets sent over path %d: %v", i, s.Path)
+		}
+		if s.RTT == 0 {
+			t.Errorf("no RTT measured over path %d: %v", i, s.Path)
+		}
+	}
+	direct, via := stats[0], stats[1]
+	if len(direct.Path.Metadata().Interfaces) > len(via.Path.Metadata().Interfaces) {
+		direct, via = via, direct
+	}
+	if direct.RTT <= via.RTT {
+		t.Errorf("expected higher RTT on the direct path, got %v and %v via %s", direct.RTT, via.RTT, ia3)
+	}
+}
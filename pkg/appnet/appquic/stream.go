@@ -0,0 +1,296 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+)
+
+const (
+	// NetworkUDP is the network name for SCION/UDP, for Dialer.
+	NetworkUDP = "scion+udp"
+	// NetworkQUIC is the network name for QUIC streams over SCION, for Dialer.
+	NetworkQUIC = "scion+quic"
+
+	// StreamProto is the TLS application protocol used by Dialer and
+	// ListenStreams if the TLS configuration does not set NextProtos.
+	StreamProto = "scion-stream"
+
+	// streamHeader is written by Dialer at the start of each stream it opens,
+	// and stripped by StreamListener. QUIC only announces a new stream to the
+	// peer with the first data sent on it; without the header, the listener
+	// would not see the stream before the client writes, and protocols where
+	// the server speaks first would hang.
+	streamHeader = "scion-stream\n"
+	// streamHeaderTimeout bounds the time the listener waits for the header
+	// of an accepted stream.
+	streamHeaderTimeout = 10 * time.Second
+)
+
+// Dialer dials SCION connections with the signature of net.Dialer's Dial and
+// DialContext, so that it can be passed to any library taking a dial function,
+// e.g. http.Transport or database drivers.
+// Supported networks are NetworkUDP, returning a connected SCION/UDP socket,
+// and NetworkQUIC, returning a single stream in a new QUIC session. The QUIC
+// streams start with a header that is stripped by StreamListener, so the
+// server side must use ListenStreams.
+type Dialer struct {
+	// TLSConfig is the TLS configuration for QUIC. If nil, server
+	// certificates are verified against the system roots and StreamProto is
+	// used as the application protocol.
+	TLSConfig *tls.Config
+	// Insecure disables the verification of server certificates, e.g. for
+	// servers using the dummy certificate of ListenStreams.
+	Insecure bool
+	// QUICConfig is the QUIC configuration, may be nil.
+	QUICConfig *quic.Config
+	// Network is used instead of the network argument if this is not one of
+	// the SCION networks, e.g. "tcp" as passed by http.Transport. If empty,
+	// other networks are rejected.
+	Network string
+}
+
+// Dial connects to the address on the network, see DialContext.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network. The address is
+// resolved with appnet.ResolveUDPAddrContext, i.e. it can either be a SCION
+// address or a host name.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != NetworkUDP && network != NetworkQUIC {
+		if d.Network == "" {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+		}
+		network = d.Network
+	}
+	raddr, err := appnet.ResolveUDPAddrContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case NetworkUDP:
+		conn, err := appnet.DialAddrContext(ctx, raddr)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	case NetworkQUIC:
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		var tlsConf *tls.Config
+		if d.TLSConfig != nil {
+			tlsConf = d.TLSConfig.Clone()
+		} else {
+			tlsConf = &tls.Config{NextProtos: []string{StreamProto}}
+		}
+		if d.Insecure {
+			tlsConf.InsecureSkipVerify = true
+		}
+		session, err := DialAddrContext(ctx, raddr, host, tlsConf, d.QUICConfig)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := session.OpenStreamSync(ctx)
+		if err != nil {
+			_ = session.CloseWithError(quic.ErrorCode(0), "")
+			return nil, err
+		}
+		if _, err := stream.Write([]byte(streamHeader)); err != nil {
+			_ = session.CloseWithError(quic.ErrorCode(0), "")
+			return nil, err
+		}
+		return NewStreamConn(session, stream), nil
+	default:
+		return nil, fmt.Errorf("appquic: invalid Dialer.Network %q", d.Network)
+	}
+}
+
+// StreamConn is a net.Conn for a single stream of a QUIC session.
+// Closing the conn closes the session.
+type StreamConn struct {
+	quic.Stream
+	session quic.Session
+}
+
+var _ net.Conn = (*StreamConn)(nil)
+
+// NewStreamConn returns a StreamConn for the stream, taking ownership of the
+// session.
+func NewStreamConn(session quic.Session, stream quic.Stream) *StreamConn {
+	return &StreamConn{Stream: stream, session: session}
+}
+
+// Session returns the QUIC session of the stream.
+func (c *StreamConn) Session() quic.Session {
+	return c.session
+}
+
+// LocalAddr returns the local network address.
+func (c *StreamConn) LocalAddr() net.Addr {
+	return c.session.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *StreamConn) RemoteAddr() net.Addr {
+	return c.session.RemoteAddr()
+}
+
+// Close closes the stream and the session.
+func (c *StreamConn) Close() error {
+	err := c.Stream.Close()
+	if cerr := c.session.CloseWithError(quic.ErrorCode(0), ""); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// StreamListener is a net.Listener accepting the first stream of each
+// incoming QUIC session, as opened by Dialer. The stream header written by
+// Dialer is stripped; streams without it are rejected.
+type StreamListener struct {
+	listener quic.Listener
+	conn     net.PacketConn
+	conns    chan *StreamConn
+
+	// failed is closed when accepting sessions fails with err
+	failed chan struct{}
+	err    error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ net.Listener = (*StreamListener)(nil)
+
+// ListenStreams listens for QUIC sessions on the SCION/UDP address and
+// returns a net.Listener for their first streams.
+// If tlsConf is nil, the dummy certificate (see GetDummyTLSCerts) and
+// StreamProto are used.
+func ListenStreams(listen *net.UDPAddr, tlsConf *tls.Config, quicConfig *quic.Config) (*StreamListener, error) {
+	if tlsConf == nil {
+		tlsConf = &tls.Config{
+			Certificates: GetDummyTLSCerts(),
+			NextProtos:   []string{StreamProto},
+		}
+	}
+	sconn, err := appnet.Listen(listen)
+	if err != nil {
+		return nil, err
+	}
+	ql, err := quic.Listen(NewReplyPathConn(sconn), tlsConf, quicConfig)
+	if err != nil {
+		sconn.Close()
+		return nil, err
+	}
+	l := &StreamListener{
+		listener: ql,
+		conn:     sconn,
+		conns:    make(chan *StreamConn),
+		failed:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go l.acceptSessions()
+	return l, nil
+}
+
+// acceptSessions accepts sessions and waits for their first streams
+// concurrently, so that a slow client does not block others.
+func (l *StreamListener) acceptSessions() {
+	for {
+		session, err := l.listener.Accept(context.Background())
+		if err != nil {
+			l.err = err
+			close(l.failed)
+			return
+		}
+		go func() {
+			stream, err := session.AcceptStream(context.Background())
+			if err != nil {
+				_ = session.CloseWithError(quic.ErrorCode(0), "")
+				return
+			}
+			if err := readStreamHeader(stream); err != nil {
+				_ = session.CloseWithError(quic.ErrorCode(0), "")
+				return
+			}
+			select {
+			case l.conns <- NewStreamConn(session, stream):
+			case <-l.closed:
+				_ = session.CloseWithError(quic.ErrorCode(0), "")
+			}
+		}()
+	}
+}
+
+// readStreamHeader reads and checks the header written by Dialer.
+func readStreamHeader(stream quic.Stream) error {
+	if err := stream.SetReadDeadline(time.Now().Add(streamHeaderTimeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, len(streamHeader))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return err
+	}
+	if string(buf) != streamHeader {
+		return errors.New("appquic: invalid stream header")
+	}
+	return stream.SetReadDeadline(time.Time{})
+}
+
+// Accept waits for and returns the next stream.
+func (l *StreamListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.failed:
+		return nil, l.err
+	case <-l.closed:
+		return nil, errors.New("appquic: listener closed")
+	}
+}
+
+// Close stops listening and closes the underlying socket, which also ends
+// the sessions of accepted streams.
+func (l *StreamListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.listener.Close()
+		if cerr := l.conn.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// Addr returns the listener's network address.
+func (l *StreamListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appquic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+)
+
+func TestDialerStreamListener(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000111}
+	topo := appnettest.NewTopology()
+	topo.SetDefault(ia)
+
+	listener, err := ListenStreams(&net.UDPAddr{IP: appnettest.HostIP, Port: 0}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	address := fmt.Sprintf("%s,%s", ia, listener.Addr())
+	// the dummy certificate of the listener is not trusted
+	if _, err := (&Dialer{Network: NetworkQUIC}).DialContext(ctx, "tcp", address); err == nil {
+		t.Fatal("expected error for untrusted server certificate")
+	}
+	d := &Dialer{Network: NetworkQUIC, Insecure: true}
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("expected echo of hello, got %q", buf)
+	}
+
+	if _, err := (&Dialer{}).DialContext(ctx, "tcp", "1-ff00:0:111,[127.0.0.1]:1234"); err == nil {
+		t.Error("expected error for unknown network")
+	}
+}
+
+// TestStreamListenerServerFirst checks that the listener accepts a stream
+// before the client writes, for protocols where the server speaks first.
+func TestStreamListenerServerFirst(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000111}
+	topo := appnettest.NewTopology()
+	topo.SetDefault(ia)
+
+	listener, err := ListenStreams(&net.UDPAddr{IP: appnettest.HostIP, Port: 0}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("welcome")); err != nil {
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d := &Dialer{Network: NetworkQUIC, Insecure: true}
+	conn, err := d.DialContext(ctx, NetworkQUIC, fmt.Sprintf("%s,%s", ia, listener.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 7)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("no greeting from server: %v", err)
+	}
+	if string(buf) != "welcome" {
+		t.Errorf("expected greeting welcome, got %q", buf)
+	}
+}
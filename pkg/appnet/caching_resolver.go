@@ -0,0 +1,152 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// DefaultCacheTTL is the maximum time an address is cached by a
+	// CachingResolver, unless configured otherwise.
+	DefaultCacheTTL = 5 * time.Minute
+	// DefaultNegativeCacheTTL is the maximum time a HostNotFoundError is
+	// cached by a CachingResolver, unless configured otherwise.
+	DefaultNegativeCacheTTL = 10 * time.Second
+
+	// cachingResolverMaxEntries bounds the size of the cache; expired entries
+	// are purged when it is exceeded.
+	cachingResolverMaxEntries = 1024
+)
+
+// CachingResolver is a Resolver caching the answers of another Resolver.
+// Addresses are cached for TTL, and HostNotFoundErrors for NegativeTTL, or
+// shorter if the wrapped resolver is a CacheableResolver reporting an earlier
+// expiry. Other errors are not cached.
+type CachingResolver struct {
+	Resolver    Resolver
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]cachedAnswer
+}
+
+type cachedAnswer struct {
+	addr   *snet.SCIONAddress // nil for HostNotFoundError
+	expiry time.Time
+}
+
+// NewCachingResolver returns a CachingResolver wrapping resolver, with the
+// default TTLs.
+func NewCachingResolver(resolver Resolver) *CachingResolver {
+	return &CachingResolver{
+		Resolver:    resolver,
+		TTL:         DefaultCacheTTL,
+		NegativeTTL: DefaultNegativeCacheTTL,
+	}
+}
+
+// Resolve implements Resolver.
+func (r *CachingResolver) Resolve(name string) (*snet.SCIONAddress, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext implements ContextResolver.
+func (r *CachingResolver) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	addr, _, err := r.ResolveCacheable(ctx, name)
+	return addr, err
+}
+
+// ResolveCacheable implements CacheableResolver, so that CachingResolvers can
+// be stacked.
+func (r *CachingResolver) ResolveCacheable(ctx context.Context,
+	name string) (*snet.SCIONAddress, time.Time, error) {
+
+	now := time.Now()
+	r.mutex.Lock()
+	e, ok := r.entries[name]
+	r.mutex.Unlock()
+	if ok && now.Before(e.expiry) {
+		if e.addr == nil {
+			return nil, e.expiry, &HostNotFoundError{name}
+		}
+		addr := *e.addr
+		return &addr, e.expiry, nil
+	}
+
+	addr, expiry, err := resolveCacheable(ctx, r.Resolver, name)
+	var errHostNotFound *HostNotFoundError
+	ttl := r.TTL
+	if err != nil {
+		if !errors.As(err, &errHostNotFound) {
+			return nil, time.Time{}, err
+		}
+		addr = nil
+		ttl = r.NegativeTTL
+	}
+	if maxExpiry := now.Add(ttl); expiry.IsZero() || expiry.After(maxExpiry) {
+		expiry = maxExpiry
+	}
+	if ttl > 0 {
+		r.store(name, cachedAnswer{addr: addr, expiry: expiry}, now)
+	}
+	if addr == nil {
+		return nil, expiry, err
+	}
+	cached := *addr
+	return &cached, expiry, nil
+}
+
+func (r *CachingResolver) store(name string, answer cachedAnswer, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[string]cachedAnswer)
+	}
+	if len(r.entries) >= cachingResolverMaxEntries {
+		for k, e := range r.entries {
+			if !now.Before(e.expiry) {
+				delete(r.entries, k)
+			}
+		}
+	}
+	if len(r.entries) < cachingResolverMaxEntries {
+		r.entries[name] = answer
+	}
+}
+
+// ResolveAddr implements ReverseResolver, if the wrapped resolver does.
+// Reverse lookups are not cached.
+func (r *CachingResolver) ResolveAddr(ctx context.Context,
+	address snet.SCIONAddress) ([]string, error) {
+
+	if reverse, ok := r.Resolver.(ReverseResolver); ok {
+		return reverse.ResolveAddr(ctx, address)
+	}
+	return nil, &HostNotFoundError{address.String()}
+}
+
+// Flush removes all cached answers.
+func (r *CachingResolver) Flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = nil
+}
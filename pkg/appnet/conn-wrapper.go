@@ -37,15 +37,17 @@ Wildcard IP Addresses
 
 snet does not currently support binding to wildcard addresses. This will hopefully be
 added soon-ish, but in the meantime, this package emulates this functionality.
-There is one restriction, that applies to hosts with multiple IP addresses in the AS:
-the behaviour will be that of binding to one specific local IP address, which means that
-the application will not be reachable using any of the other IP addresses.
-Traffic sent will always appear to originate from this specific IP address,
-even if that's not the correct route to a destination in the local AS.
-
-This restriction will very likely not cause any issues, as a fairly contrived
-network setup would be required. Also, sciond has a similar restriction (binds
-to one specific IP address).
+When listening on a wildcard address, the conn is registered at the dispatcher
+on each of the local IP addresses of this host (of the same IP family as the
+address used to reach the local AS) and packets from all of these are
+multiplexed.
+Replies to a remote always leave from the local address on which the most
+recent packet from this remote arrived. Traffic to other destinations
+originates from the IP address used to reach the next hop.
+The LocalAddr of such a conn reports the default local IP address.
+
+When dialing, the conn is bound to one specific local IP address, determined
+by the next hop towards the destination.
 */
 package appnet
 
@@ -0,0 +1,85 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// dnsTXTPrefix is the prefix of the DNS TXT records containing a SCION
+// address, e.g. "scion=1-ff00:0:110,[10.0.0.1]".
+const dnsTXTPrefix = "scion="
+
+// DNSResolver is a Resolver looking up SCION addresses in the DNS TXT records
+// of the name. The address is expected in a record of the form
+// "scion=1-ff00:0:110,[10.0.0.1]"; other TXT records are ignored.
+type DNSResolver struct {
+	// Server is the address (host:port) of the DNS server to query. If empty,
+	// the servers configured for the system are used.
+	Server string
+}
+
+// Resolve implements Resolver.
+func (r *DNSResolver) Resolve(name string) (*snet.SCIONAddress, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext implements ContextResolver.
+func (r *DNSResolver) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	txts, err := r.resolver().LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, &HostNotFoundError{name}
+	} else if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, dnsTXTPrefix) {
+			continue
+		}
+		addr, err := addrFromString(strings.TrimSpace(strings.TrimPrefix(txt, dnsTXTPrefix)))
+		if err != nil {
+			continue
+		}
+		return &addr, nil
+	}
+	return nil, &HostNotFoundError{name}
+}
+
+func (r *DNSResolver) resolver() *net.Resolver {
+	if r.Server == "" {
+		return net.DefaultResolver
+	}
+	server := r.Server
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// isTransientDNSError returns true if err is a DNS failure that does not say
+// anything about the name, e.g. a timeout or an unreachable DNS server.
+func isTransientDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// stubDNSServer answers TXT queries over UDP from a fixed table. Unknown names
+// are answered with NXDOMAIN.
+type stubDNSServer struct {
+	conn net.PacketConn
+	txts map[string][]string
+}
+
+func newStubDNSServer(t *testing.T, txts map[string][]string) *stubDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubDNSServer{conn: conn, txts: txts}
+	go s.serve()
+	return s
+}
+
+func (s *stubDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := s.reply(buf[:n]); reply != nil {
+			_, _ = s.conn.WriteTo(reply, from)
+		}
+	}
+}
+
+// reply builds the response to the query, copying its header and question.
+func (s *stubDNSServer) reply(query []byte) []byte {
+	const headerLen = 12
+	var labels []string
+	i := headerLen
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	questionEnd := i + 1 + 4 // terminating label, type, class
+	if questionEnd > len(query) {
+		return nil
+	}
+	name := strings.Join(labels, ".")
+	txts, found := s.txts[name]
+
+	msg := append([]byte(nil), query[:questionEnd]...)
+	flags := uint16(0x8180) // response, recursion desired and available
+	if !found {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(txts))) // answers
+	binary.BigEndian.PutUint16(msg[8:], 0)
+	binary.BigEndian.PutUint16(msg[10:], 0)
+	for _, txt := range txts {
+		msg = append(msg, 0xc0, headerLen) // pointer to the name in the question
+		msg = append(msg, 0, 16, 0, 1)     // type TXT, class IN
+		msg = append(msg, 0, 0, 0, 60)     // TTL
+		msg = append(msg, 0, byte(len(txt)+1), byte(len(txt)))
+		msg = append(msg, txt...)
+	}
+	return msg
+}
+
+func (s *stubDNSServer) Close() {
+	s.conn.Close()
+}
+
+func TestDNSResolver(t *testing.T) {
+	server := newStubDNSServer(t, map[string][]string{
+		"host1.example.org": {"v=spf1 -all", "scion=17-ffaa:0:1,[192.168.1.1]"},
+		"host2.example.org": {"scion=20-ffaa:c0ff:ee12,[::ff1:ce00:dead:10cc:baad:f00d]"},
+		"plain.example.org": {"some other record"},
+	})
+	defer server.Close()
+	resolver := &DNSResolver{Server: server.conn.LocalAddr().String()}
+
+	cases := []testCase{
+		{"host1.example.org.", mustParse("17-ffaa:0:1,[192.168.1.1]")},
+		{"host2.example.org.", mustParse("20-ffaa:c0ff:ee12,[::ff1:ce00:dead:10cc:baad:f00d]")},
+		{"plain.example.org.", nil},
+		{"unknown.example.org.", nil},
+	}
+	testResolver(t, resolver, cases)
+}
+
+func TestDNSResolverUnreachable(t *testing.T) {
+	// no DNS server listening at this address
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := conn.LocalAddr().String()
+	conn.Close()
+	dns := &DNSResolver{Server: server}
+
+	var errHostNotFound *HostNotFoundError
+	if _, err := dns.Resolve("unknown.example.org."); err == nil || errors.As(err, &errHostNotFound) {
+		t.Fatalf("expected DNS error, got %v", err)
+	}
+	c := &resolverConfig{
+		entries: []resolverEntry{{kindHosts, &hostsfileResolver{path: hostsTestFile}}},
+	}
+	for _, position := range []DNSPosition{DNSFirst, DNSLast} {
+		list := c.list(dns, position)
+		// names from other sources are resolved despite the DNS failure
+		if _, err := list.Resolve("host2"); err != nil {
+			t.Errorf("expected name from hosts file with DNS position %d, got %v", position, err)
+		}
+		// the DNS error is reported for names not found elsewhere
+		if _, err := list.Resolve("unknown.example.org."); err == nil ||
+			errors.As(err, &errHostNotFound) {
+			t.Errorf("expected DNS error with DNS position %d, got %v", position, err)
+		}
+	}
+}
@@ -15,19 +15,47 @@
 package appnet
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"regexp"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
 var (
-	resolveEtcHosts      Resolver = &hostsfileResolver{"/etc/hosts"}
-	resolveEtcScionHosts Resolver = &hostsfileResolver{"/etc/scion/hosts"}
+	resolveEtcHosts      Resolver = &hostsfileResolver{path: "/etc/hosts"}
+	resolveEtcScionHosts Resolver = &hostsfileResolver{path: "/etc/scion/hosts"}
 	resolveRains         Resolver = nil
+	// newRainsResolver creates a RAINS resolver for the server, nil if built
+	// with norains.
+	newRainsResolver func(server *snet.UDPAddr, timeout time.Duration) Resolver
+
+	resolverMutex sync.Mutex
+	resolverConf  *resolverConfig // loaded on first use
+	// resolveDNS, if set by SetDNSResolver, replaces the DNS resolvers of the
+	// configuration and is inserted at dnsPosition.
+	resolveDNS  Resolver
+	dnsPosition DNSPosition
+)
+
+// DNSPosition is the position of the DNS TXT record resolver in the list of
+// sources used by DefaultResolver.
+type DNSPosition int
+
+const (
+	// DNSLast queries DNS after all other sources. This is the default.
+	DNSLast DNSPosition = iota
+	// DNSBeforeRains queries DNS after the hosts files, but before RAINS.
+	DNSBeforeRains
+	// DNSFirst queries DNS before any other source.
+	DNSFirst
+	// DNSDisabled does not query DNS.
+	DNSDisabled
 )
 
 var (
@@ -35,6 +63,9 @@ var (
 	hostPortRegexp = regexp.MustCompile(`^((?:[-.\da-zA-Z]+)|(?:\d+-[\d:A-Fa-f]+,(\[[^\]]+\]|[^\]:]+))):(\d+)$`)
 )
 
+// formatAddrTimeout bounds the reverse lookup in FormatAddr.
+const formatAddrTimeout = 500 * time.Millisecond
+
 const (
 	addrRegexpIaIndex = 1
 	addrRegexpL3Index = 2
@@ -61,7 +92,14 @@ const (
 // If the address is in the form of a hostname, the DefaultResolver is used to
 // resolve the name.
 func ResolveUDPAddr(address string) (*snet.UDPAddr, error) {
-	return ResolveUDPAddrAt(address, DefaultResolver())
+	return ResolveUDPAddrContext(context.Background(), address)
+}
+
+// ResolveUDPAddrContext parses the address and resolves the hostname,
+// analogous to ResolveUDPAddr.
+// The context bounds the name resolution.
+func ResolveUDPAddrContext(ctx context.Context, address string) (*snet.UDPAddr, error) {
+	return ResolveUDPAddrAtContext(ctx, address, DefaultResolver())
 }
 
 // ResolveUDPAddrAt parses the address and resolves the hostname.
@@ -69,6 +107,13 @@ func ResolveUDPAddr(address string) (*snet.UDPAddr, error) {
 // or in the form of "hostname:port".
 // If the address is in the form of a hostname, resolver is used to resolve the name.
 func ResolveUDPAddrAt(address string, resolver Resolver) (*snet.UDPAddr, error) {
+	return ResolveUDPAddrAtContext(context.Background(), address, resolver)
+}
+
+// ResolveUDPAddrAtContext parses the address and resolves the hostname,
+// analogous to ResolveUDPAddrAt.
+// The context bounds the name resolution if resolver is a ContextResolver.
+func ResolveUDPAddrAtContext(ctx context.Context, address string, resolver Resolver) (*snet.UDPAddr, error) {
 
 	raddr, err := snet.ParseUDPAddr(address)
 	if err == nil {
@@ -82,7 +127,7 @@ func ResolveUDPAddrAt(address string, resolver Resolver) (*snet.UDPAddr, error)
 	if err != nil {
 		return nil, err
 	}
-	host, err := resolver.Resolve(hostStr)
+	host, err := resolveContext(ctx, resolver, hostStr)
 	if err != nil {
 		return nil, err
 	}
@@ -91,19 +136,86 @@ func ResolveUDPAddrAt(address string, resolver Resolver) (*snet.UDPAddr, error)
 }
 
 // DefaultResolver returns the default name resolver, used in ResolveUDPAddr.
-// It will use the following sources, in the given order of precedence, to
-// resolve a name:
+// The sources used to resolve a name, and their order of precedence, are read
+// from the resolver configuration file, /etc/scion/resolv.conf or the path set
+// in the SCION_RESOLV_CONF environment variable. The file is loaded on first
+// use. Example:
+//
+//	# static entries, always checked first
+//	static 17-ffaa:0:1,[192.168.1.1] host1 host1.example.org
+//	hosts /etc/hosts
+//	hosts /etc/scion/hosts
+//	rains 19-ffaa:0:1,[10.0.0.1]:55553 timeout=1s
+//	dns 10.0.0.53:53
+//
+// If the file does not exist, the following sources are used, in the given
+// order of precedence:
 //
 //  - /etc/hosts
 //  - /etc/scion/hosts
 //  - RAINS, if a server is configured in /etc/scion/rains.cfg.
 //    Disabled if built with !norains.
+//  - DNS TXT records, see DNSResolver.
+//
+// The position of DNS in this order can be changed with SetDNSResolver.
+// Transient DNS failures, e.g. an unreachable DNS server, do not prevent
+// resolving names found in the other sources; the DNS error is only returned
+// if the name is not found anywhere else.
+//
+// The answers of RAINS and DNS are cached, see CachingResolver. Hosts files
+// are reloaded when they change.
 func DefaultResolver() Resolver {
-	return ResolverList{
-		resolveEtcHosts,
-		resolveEtcScionHosts,
-		resolveRains,
+	resolverMutex.Lock()
+	defer resolverMutex.Unlock()
+	if resolverConf == nil {
+		resolverConf = loadDefaultResolverConfig()
+	}
+	return resolverConf.list(resolveDNS, dnsPosition)
+}
+
+// SetDNSResolver configures the DNS TXT record resolver used by
+// DefaultResolver, replacing any DNS resolvers from the configuration file.
+// The server (host:port) is the DNS server to query, or empty to use the
+// servers configured for the system.
+func SetDNSResolver(server string, position DNSPosition) {
+	resolverMutex.Lock()
+	defer resolverMutex.Unlock()
+	resolveDNS = NewCachingResolver(&DNSResolver{Server: server})
+	dnsPosition = position
+}
+
+// LookupAddr returns the host names of the address, found using the
+// DefaultResolver. The port of the address is ignored.
+func LookupAddr(address *snet.UDPAddr) ([]string, error) {
+	return LookupAddrContext(context.Background(), address)
+}
+
+// LookupAddrContext returns the host names of the address, analogous to
+// LookupAddr.
+// The context bounds the lookup.
+func LookupAddrContext(ctx context.Context, address *snet.UDPAddr) ([]string, error) {
+	host := snet.SCIONAddress{IA: address.IA, Host: addr.HostFromIP(address.Host.IP)}
+	return DefaultResolver().(ReverseResolver).ResolveAddr(ctx, host)
+}
+
+// FormatAddr formats the address for log messages and other human readable
+// output. For SCION addresses with a host name, the name is added, e.g.
+// "host1 (17-ffaa:0:1,[192.168.1.1]:22)".
+func FormatAddr(address net.Addr) string {
+	if address == nil {
+		return "<nil>"
+	}
+	udpAddr, ok := address.(*snet.UDPAddr)
+	if !ok || udpAddr.Host == nil {
+		return address.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), formatAddrTimeout)
+	defer cancel()
+	names, err := LookupAddrContext(ctx, udpAddr)
+	if err != nil {
+		return address.String()
 	}
+	return fmt.Sprintf("%s (%s)", names[0], address)
 }
 
 // MangleSCIONAddr mangles a SCION address string (if it is one) so it can be
@@ -16,37 +16,132 @@ package appnet
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
 type hostsTable map[string]snet.SCIONAddress
 
+// Resolve implements Resolver, for static entries.
+func (t hostsTable) Resolve(name string) (*snet.SCIONAddress, error) {
+	addr, ok := t[name]
+	if !ok {
+		return nil, &HostNotFoundError{name}
+	}
+	return &addr, nil
+}
+
+// ResolveContext implements ContextResolver, for static entries.
+func (t hostsTable) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	return t.Resolve(name)
+}
+
+// ResolveAddr implements ReverseResolver, for static entries. The names are
+// returned in lexical order.
+func (t hostsTable) ResolveAddr(ctx context.Context, address snet.SCIONAddress) ([]string, error) {
+	var names []string
+	for name, addr := range t {
+		if addr.IA == address.IA && addr.Host.Equal(address.Host) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, &HostNotFoundError{address.String()}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hostsfileCheckInterval is the minimum time between checks whether the hosts
+// file has changed.
+const hostsfileCheckInterval = 1 * time.Second
+
 // hostsfileResolver is an implementation of the resolver interface, backed
 // by an /etc/hosts-like file.
+// The file is parsed once and reloaded when its modification time or size
+// changes, which is checked at most every hostsfileCheckInterval.
 type hostsfileResolver struct {
 	path string
+
+	mutex   sync.Mutex
+	table   hostsTable
+	modTime time.Time
+	size    int64
+	checked time.Time
 }
 
-// Resolve implements
+// Resolve implements Resolver.
 func (r *hostsfileResolver) Resolve(name string) (*snet.SCIONAddress, error) {
+	return r.ResolveContext(context.Background(), name)
+}
 
-	// Note: obviously not perfectly elegant to parse the entire file for
-	// every query. However, properly caching this and still always provide
-	// fresh results after changes to the hosts file seems like a bigger task and
-	// for now that would be overkill.
-	table, err := loadHostsFile(r.path)
-	if err != nil {
-		return nil, fmt.Errorf("error loading %s: %s", r.path, err)
+// ResolveContext implements ContextResolver.
+func (r *hostsfileResolver) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	addr, _, err := r.ResolveCacheable(ctx, name)
+	return addr, err
+}
+
+// ResolveCacheable implements CacheableResolver. Answers are valid until the
+// next check for changes of the file.
+func (r *hostsfileResolver) ResolveCacheable(ctx context.Context,
+	name string) (*snet.SCIONAddress, time.Time, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.reloadIfChanged(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("error loading %s: %s", r.path, err)
 	}
-	addr, ok := table[name]
+	expiry := r.checked.Add(hostsfileCheckInterval)
+	addr, ok := r.table[name]
 	if !ok {
-		return nil, &HostNotFoundError{name}
+		return nil, expiry, &HostNotFoundError{name}
 	}
-	return &addr, nil
+	return &addr, expiry, nil
+}
+
+// ResolveAddr implements ReverseResolver.
+func (r *hostsfileResolver) ResolveAddr(ctx context.Context,
+	address snet.SCIONAddress) ([]string, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.reloadIfChanged(); err != nil {
+		return nil, fmt.Errorf("error loading %s: %s", r.path, err)
+	}
+	return r.table.ResolveAddr(ctx, address)
+}
+
+// reloadIfChanged reloads the file if it has changed since it was last loaded.
+// The caller must hold the mutex.
+func (r *hostsfileResolver) reloadIfChanged() error {
+	now := time.Now()
+	if !r.checked.IsZero() && now.Sub(r.checked) < hostsfileCheckInterval {
+		return nil
+	}
+	var modTime time.Time
+	var size int64
+	info, err := os.Stat(r.path)
+	if err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if r.checked.IsZero() || !modTime.Equal(r.modTime) || size != r.size {
+		table, err := loadHostsFile(r.path)
+		if err != nil {
+			return err
+		}
+		r.table, r.modTime, r.size = table, modTime, size
+	}
+	r.checked = now
+	return nil
 }
 
 func loadHostsFile(path string) (hostsTable, error) {
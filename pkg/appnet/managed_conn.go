@@ -0,0 +1,501 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// pathRefreshLead is how long before the expiry of the current path a
+	// ManagedConn queries for a fresh path.
+	pathRefreshLead = 1 * time.Minute
+	// pathRefreshRetry is the delay before retrying a failed path refresh.
+	pathRefreshRetry = 5 * time.Second
+	// ifaceDownTimeout is how long an interface reported down by SCMP, or a
+	// path considered failed, is avoided when choosing a path.
+	ifaceDownTimeout = 10 * time.Second
+	// silenceCheckInterval is the interval for checking whether the remote has
+	// stopped replying, see SetFailoverOnSilence.
+	silenceCheckInterval = 500 * time.Millisecond
+)
+
+// ifaceKey identifies an interface of an AS.
+type ifaceKey struct {
+	ia   addr.IA
+	ifid common.IFIDType
+}
+
+// ManagedConn is a connected SCION/UDP conn which keeps the path to the remote
+// up to date.
+//
+// The path is re-queried before it expires. When an SCMP interface down
+// message (SCMPTypeExternalInterfaceDown, SCMPTypeInternalConnectivityDown)
+// for an interface on the current path is received, the conn fails over to an
+// alternate path avoiding this interface. Likewise, when an SCMP packet too
+// big message shows that the current path cannot carry the minimum payload
+// size (see SetMinPayloadSize), the conn switches to a path that can.
+// Note that SCMP messages are only processed while reading from the conn.
+//
+// ManagedConn implements both net.Conn and net.PacketConn; packets written
+// with WriteTo to any address other than the remote are sent unchanged.
+type ManagedConn struct {
+	conn *snet.Conn
+
+	mutex      sync.Mutex
+	remote     *snet.UDPAddr // replaced, never modified, on path change
+	path       snet.Path
+	downIfaces map[ifaceKey]time.Time
+	badPaths   map[snet.PathFingerprint]time.Time
+	minPayload int
+
+	onPathChange    func(old, new snet.Path)
+	silenceTimeout  time.Duration
+	firstUnanswered time.Time // first packet sent since last packet received from remote
+
+	refresh   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// DialManaged connects to the address (on the SCION/UDP network), analogous
+// to Dial, and keeps the path up to date for the lifetime of the conn.
+func DialManaged(address string) (*ManagedConn, error) {
+	raddr, err := ResolveUDPAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	return DialAddrManaged(raddr)
+}
+
+// DialAddrManaged connects to the address (on the SCION/UDP network) and
+// keeps the path up to date for the lifetime of the conn.
+// Any path set in raddr is ignored; the conn starts with the first available
+// path.
+func DialAddrManaged(raddr *snet.UDPAddr) (*ManagedConn, error) {
+	remote := raddr.Copy()
+	paths, err := QueryPaths(remote.IA)
+	if err != nil {
+		return nil, err
+	}
+	var path snet.Path
+	if len(paths) > 0 {
+		path = paths[0]
+	}
+	SetPath(remote, path)
+	localIP, err := DefNetwork().resolveLocal(remote)
+	if err != nil {
+		return nil, err
+	}
+	laddr := &net.UDPAddr{IP: localIP}
+	conn, err := DefNetwork().Listen(context.Background(), "udp", laddr, addr.SvcNone)
+	if err != nil {
+		return nil, err
+	}
+	c := &ManagedConn{
+		conn:       conn,
+		remote:     remote,
+		path:       path,
+		downIfaces: make(map[ifaceKey]time.Time),
+		badPaths:   make(map[snet.PathFingerprint]time.Time),
+		refresh:    make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	if path != nil { // nil for local IA, nothing to manage
+		addIfaceDownObserver(c)
+		go c.run()
+	}
+	return c, nil
+}
+
+// SetPathChangeHandler registers a function that is called whenever the conn
+// switches to a different path.
+func (c *ManagedConn) SetPathChangeHandler(handler func(old, new snet.Path)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onPathChange = handler
+}
+
+// SetFailoverOnSilence enables failover when the remote stops replying: if no
+// packet has been received from the remote for the duration d while sending
+// to it, the current path is considered broken and the conn switches to
+// another path.
+// This is only meaningful for protocols where the remote regularly replies,
+// e.g. with acknowledgements. Disabled by default, or if d is 0.
+func (c *ManagedConn) SetFailoverOnSilence(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.silenceTimeout = d
+}
+
+// SetMinPayloadSize restricts the conn to paths over which payloads of the
+// given size can be sent, see MaxPayloadSize. If the current path does not
+// allow this, the conn switches to another path immediately; an error is
+// returned if there is no such path.
+func (c *ManagedConn) SetMinPayloadSize(size int) error {
+	c.mutex.Lock()
+	c.minPayload = size
+	path, ia := c.path, c.remote.IA
+	c.mutex.Unlock()
+	if path == nil || MaxPayloadSize(path) >= size {
+		return nil
+	}
+	if err := c.updatePath(); err != nil {
+		return fmt.Errorf("no path to %s with MTU sufficient for %d bytes of payload: %w",
+			ia, size, err)
+	}
+	return nil
+}
+
+// Read reads a packet from the conn. Packets from any source are accepted.
+func (c *ManagedConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+// ReadFrom reads a packet from the conn.
+func (c *ManagedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, from, err := c.conn.ReadFrom(b)
+	if a, ok := from.(*snet.UDPAddr); ok && err == nil {
+		c.mutex.Lock()
+		if sameHost(a, c.remote) {
+			c.firstUnanswered = time.Time{}
+		}
+		c.mutex.Unlock()
+	}
+	return n, from, err
+}
+
+// Write sends a packet to the remote, over the current path.
+func (c *ManagedConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	remote := c.remote
+	if c.firstUnanswered.IsZero() {
+		c.firstUnanswered = time.Now()
+	}
+	c.mutex.Unlock()
+	return c.conn.WriteTo(b, remote)
+}
+
+// WriteTo sends a packet to addr. If addr is the remote of this conn, the
+// packet is sent over the current path, as with Write.
+func (c *ManagedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if a, ok := addr.(*snet.UDPAddr); ok {
+		c.mutex.Lock()
+		isRemote := sameHost(a, c.remote)
+		c.mutex.Unlock()
+		if isRemote {
+			return c.Write(b)
+		}
+	}
+	return c.conn.WriteTo(b, addr)
+}
+
+// Close closes the conn and stops the path management.
+func (c *ManagedConn) Close() error {
+	c.closeOnce.Do(func() {
+		removeIfaceDownObserver(c)
+		close(c.closed)
+	})
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local address of the conn.
+func (c *ManagedConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address, including the current path.
+func (c *ManagedConn) RemoteAddr() net.Addr {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.remote.Copy()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying conn.
+func (c *ManagedConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying conn.
+func (c *ManagedConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying conn.
+func (c *ManagedConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Path returns the path currently used to send to the remote.
+// Returns nil if the remote is in the local IA.
+func (c *ManagedConn) Path() snet.Path {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.path
+}
+
+// PathMTU returns the MTU of the path currently used to send to the remote,
+// see Network.PathMTU. This decreases when an SCMP packet too big message is
+// received for the path.
+func (c *ManagedConn) PathMTU() int {
+	return DefNetwork().PathMTU(c.Path())
+}
+
+// MaxPayloadSize returns the size of the largest payload that can be sent in
+// a single Write without exceeding the MTU of the current path.
+func (c *ManagedConn) MaxPayloadSize() int {
+	c.mutex.Lock()
+	remote, path := c.remote, c.path
+	c.mutex.Unlock()
+	local := c.conn.LocalAddr().(*snet.UDPAddr)
+	return payloadSize(DefNetwork().PathMTU(path), remote.Path, local.Host.IP, remote.Host.IP)
+}
+
+// run refreshes the path before expiry or when triggered by an interface down
+// event, until the conn is closed.
+func (c *ManagedConn) run() {
+	timer := time.NewTimer(c.nextRefresh())
+	defer timer.Stop()
+	ticker := time.NewTicker(silenceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-timer.C:
+		case <-c.refresh:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case now := <-ticker.C:
+			if !c.checkSilence(now) {
+				continue
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		next := pathRefreshRetry
+		if err := c.updatePath(); err == nil {
+			next = c.nextRefresh()
+		}
+		timer.Reset(next)
+	}
+}
+
+// nextRefresh returns the duration until the current path should be refreshed.
+func (c *ManagedConn) nextRefresh() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.path == nil || c.path.Metadata() == nil {
+		return pathRefreshRetry
+	}
+	d := time.Until(c.path.Metadata().Expiry.Add(-pathRefreshLead))
+	if d < pathRefreshRetry {
+		return pathRefreshRetry
+	}
+	return d
+}
+
+// checkSilence returns true if failover on silence is enabled and the remote
+// has not replied for too long. In this case, the current path is marked as
+// failed.
+func (c *ManagedConn) checkSilence(now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.silenceTimeout == 0 || c.path == nil || c.firstUnanswered.IsZero() ||
+		now.Sub(c.firstUnanswered) < c.silenceTimeout {
+		return false
+	}
+	c.badPaths[snet.Fingerprint(c.path)] = now
+	// only the next Write re-arms the detection; the unanswered packet may not
+	// have required a reply (e.g. a QUIC ACK on an idle session)
+	c.firstUnanswered = time.Time{}
+	return true
+}
+
+// updatePath queries paths to the remote and switches to the best available
+// path.
+func (c *ManagedConn) updatePath() error {
+	c.mutex.Lock()
+	ia := c.remote.IA
+	c.mutex.Unlock()
+	paths, err := QueryPaths(ia)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	path := c.choosePath(paths, time.Now())
+	if path == nil {
+		c.mutex.Unlock()
+		return errors.New("no path available avoiding interfaces reported down")
+	}
+	old := c.path
+	// the path of the current remote is not copied, as writes in flight
+	// serialize it in place
+	remote := &snet.UDPAddr{IA: c.remote.IA, Host: c.remote.Host}
+	SetPath(remote, path)
+	c.remote = remote
+	c.path = path
+	handler := c.onPathChange
+	c.mutex.Unlock()
+
+	if handler != nil && (old == nil || snet.Fingerprint(old) != snet.Fingerprint(path)) {
+		handler(old, path)
+	}
+	return nil
+}
+
+// choosePath chooses a path from paths, skipping paths over interfaces that
+// have recently been reported down, paths that have recently failed and paths
+// with an MTU too small for the minimum payload size.
+// A fresh version of the current path is preferred, otherwise the first
+// usable path is returned.
+func (c *ManagedConn) choosePath(paths []snet.Path, now time.Time) snet.Path {
+	for k, t := range c.downIfaces {
+		if now.Sub(t) > ifaceDownTimeout {
+			delete(c.downIfaces, k)
+		}
+	}
+	for k, t := range c.badPaths {
+		if now.Sub(t) > ifaceDownTimeout {
+			delete(c.badPaths, k)
+		}
+	}
+	var current snet.PathFingerprint
+	if c.path != nil {
+		current = snet.Fingerprint(c.path)
+	}
+	var first snet.Path
+	for _, p := range paths {
+		if c.usesDownIface(p) || (c.minPayload > 0 && MaxPayloadSize(p) < c.minPayload) {
+			continue
+		}
+		if snet.Fingerprint(p) == current {
+			return p
+		}
+		if first == nil {
+			first = p
+		}
+	}
+	return first
+}
+
+func (c *ManagedConn) usesDownIface(path snet.Path) bool {
+	if path == nil || path.Metadata() == nil {
+		return false
+	}
+	if _, bad := c.badPaths[snet.Fingerprint(path)]; bad {
+		return true
+	}
+	for _, intf := range path.Metadata().Interfaces {
+		if _, down := c.downIfaces[ifaceKey{intf.IA, intf.ID}]; down {
+			return true
+		}
+	}
+	return false
+}
+
+// ifaceDown records that the interfaces have been reported down and triggers
+// a path update if the current path is affected.
+func (c *ManagedConn) ifaceDown(ifaces []ifaceKey) {
+	c.mutex.Lock()
+	now := time.Now()
+	for _, k := range ifaces {
+		c.downIfaces[k] = now
+	}
+	affected := c.usesDownIface(c.path)
+	c.mutex.Unlock()
+
+	if affected {
+		select {
+		case c.refresh <- struct{}{}:
+		default: // refresh already pending
+		}
+	}
+}
+
+// pathMTUChanged triggers a path update if the current path can no longer
+// carry payloads of the minimum payload size, e.g. after an SCMP packet too
+// big message.
+func (c *ManagedConn) pathMTUChanged() {
+	c.mutex.Lock()
+	affected := c.path != nil && c.minPayload > 0 && MaxPayloadSize(c.path) < c.minPayload
+	c.mutex.Unlock()
+
+	if affected {
+		select {
+		case c.refresh <- struct{}{}:
+		default: // refresh already pending
+		}
+	}
+}
+
+// sameHost returns true if a and b refer to the same SCION host and port.
+func sameHost(a, b *snet.UDPAddr) bool {
+	return a.IA == b.IA && a.Host.IP.Equal(b.Host.IP) && a.Host.Port == b.Host.Port
+}
+
+// ifaceDownObservers are the ManagedConns notified about interface down and
+// packet too big SCMP messages by the sCMPHandler.
+var ifaceDownObservers = struct {
+	sync.Mutex
+	conns map[*ManagedConn]struct{}
+}{conns: make(map[*ManagedConn]struct{})}
+
+func addIfaceDownObserver(c *ManagedConn) {
+	ifaceDownObservers.Lock()
+	defer ifaceDownObservers.Unlock()
+	ifaceDownObservers.conns[c] = struct{}{}
+}
+
+func removeIfaceDownObserver(c *ManagedConn) {
+	ifaceDownObservers.Lock()
+	defer ifaceDownObservers.Unlock()
+	delete(ifaceDownObservers.conns, c)
+}
+
+// ifaceDownObserverConns returns a snapshot of the registered ManagedConns.
+func ifaceDownObserverConns() []*ManagedConn {
+	ifaceDownObservers.Lock()
+	defer ifaceDownObservers.Unlock()
+	conns := make([]*ManagedConn, 0, len(ifaceDownObservers.conns))
+	for c := range ifaceDownObservers.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func notifyIfaceDown(ifaces ...ifaceKey) {
+	for _, c := range ifaceDownObserverConns() {
+		c.ifaceDown(ifaces)
+	}
+}
+
+func notifyPathMTU() {
+	for _, c := range ifaceDownObserverConns() {
+		c.pathMTUChanged()
+	}
+}
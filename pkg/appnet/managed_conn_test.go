@@ -0,0 +1,112 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+)
+
+func makeTestPath(ia addr.IA, ifids ...common.IFIDType) snet.Path {
+	intfs := make([]snet.PathInterface, len(ifids))
+	for i, ifid := range ifids {
+		intfs[i] = snet.PathInterface{IA: ia, ID: ifid}
+	}
+	return &snetpath.Path{Meta: snet.PathMetadata{Interfaces: intfs}}
+}
+
+func TestManagedConnChoosePath(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000110}
+	p12 := makeTestPath(ia, 1, 2)
+	p34 := makeTestPath(ia, 3, 4)
+	p56 := makeTestPath(ia, 5, 6)
+	paths := []snet.Path{p12, p34, p56}
+
+	now := time.Now()
+	cases := []struct {
+		name     string
+		current  snet.Path
+		down     map[ifaceKey]time.Time
+		expected snet.Path
+	}{
+		{"first", nil, nil, p12},
+		{"keep current", p34, nil, p34},
+		{"avoid down", p12, map[ifaceKey]time.Time{{ia, 2}: now}, p34},
+		{"down expired", p12, map[ifaceKey]time.Time{{ia, 2}: now.Add(-2 * ifaceDownTimeout)}, p12},
+		{"all down", p12, map[ifaceKey]time.Time{{ia, 1}: now, {ia, 3}: now, {ia, 6}: now}, nil},
+	}
+	for _, c := range cases {
+		down := make(map[ifaceKey]time.Time)
+		for k, v := range c.down {
+			down[k] = v
+		}
+		conn := &ManagedConn{path: c.current, downIfaces: down}
+		actual := conn.choosePath(paths, now)
+		if actual != c.expected {
+			t.Errorf("%s: expected path %v, got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+// noMetadataPath is a path without metadata, as e.g. returned for paths
+// extracted from received packets.
+type noMetadataPath struct {
+	basePath
+}
+
+type basePath interface {
+	snet.Path
+}
+
+func (noMetadataPath) Metadata() *snet.PathMetadata {
+	return nil
+}
+
+func TestManagedConnNextRefresh(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000110}
+	expiring := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: []snet.PathInterface{{IA: ia, ID: 1}},
+		Expiry:     time.Now().Add(time.Hour),
+	}}
+
+	cases := []struct {
+		name string
+		path snet.Path
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"expiry", expiring, time.Hour - pathRefreshLead - time.Minute, time.Hour - pathRefreshLead},
+		{"expired", makeTestPath(ia, 1), pathRefreshRetry, pathRefreshRetry},
+		{"no metadata", noMetadataPath{&snetpath.Path{}}, pathRefreshRetry, pathRefreshRetry},
+		{"no path", nil, pathRefreshRetry, pathRefreshRetry},
+	}
+	for _, c := range cases {
+		conn := &ManagedConn{path: c.path}
+		actual := conn.nextRefresh()
+		if actual < c.min || actual > c.max {
+			t.Errorf("%s: expected refresh in [%v, %v], got %v", c.name, c.min, c.max, actual)
+		}
+	}
+
+	conn := &ManagedConn{path: noMetadataPath{&snetpath.Path{}}, downIfaces: map[ifaceKey]time.Time{{ia, 1}: time.Now()}}
+	if conn.usesDownIface(conn.path) {
+		t.Errorf("path without metadata reported to use a down interface")
+	}
+}
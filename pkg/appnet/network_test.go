@@ -0,0 +1,83 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+)
+
+func TestIndependentNetworks(t *testing.T) {
+	topo := appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1)
+	// the default network is in an unrelated topology; it must not be used
+	appnettest.NewTopology().SetDefault(ia3)
+
+	n1 := topo.Network(ia1)
+	n2 := topo.Network(ia2)
+	defer n2.Close()
+
+	server, err := n2.ListenUDP(&net.UDPAddr{IP: appnettest.HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	if paths, err := n1.QueryPaths(ia2); err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 path from %s to %s, got %v, %v", ia1, ia2, paths, err)
+	}
+	client, err := n1.DialUDP(fmt.Sprintf("%s,[%s]:1234", ia2, appnettest.HostIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_ = server.SetReadDeadline(time.Now().Add(time.Second))
+	n, from, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" || from.(*snet.UDPAddr).IA != ia1 {
+		t.Errorf("expected hello from %s, got %q from %v", ia1, buf[:n], from)
+	}
+	if _, err := server.WriteTo([]byte("world"), from); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err = client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Errorf("expected reply world, got %q", buf[:n])
+	}
+
+	// closing one network does not affect the other
+	if err := n1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if paths, err := n2.QueryPaths(ia1); err != nil || len(paths) != 1 {
+		t.Errorf("expected 1 path from %s to %s, got %v, %v", ia2, ia1, paths, err)
+	}
+}
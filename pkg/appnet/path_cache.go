@@ -0,0 +1,261 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// pathCacheRefreshLead is how long before the expiry of the first cached
+	// path to a destination the paths are queried again. This is larger than
+	// pathRefreshLead, so that ManagedConns find fresh paths in the cache.
+	pathCacheRefreshLead = 2 * pathRefreshLead
+	// pathCacheMaxAge is the maximum time between queries for the paths to a
+	// destination, to pick up new paths.
+	pathCacheMaxAge = 5 * time.Minute
+	// pathCacheIdleTimeout is the time after which the paths to a destination
+	// that have not been used are evicted instead of refreshed.
+	pathCacheIdleTimeout = 10 * time.Minute
+	// pathQueryTimeout bounds the queries to sciond, independent of the
+	// contexts of the callers waiting for the result.
+	pathQueryTimeout = 10 * time.Second
+)
+
+// PathCacheMetrics are the counters of the path cache of a Network.
+type PathCacheMetrics struct {
+	// Hits is the number of lookups answered from the cache.
+	Hits uint64
+	// Misses is the number of lookups that waited for a query to sciond.
+	Misses uint64
+	// Queries is the number of queries to sciond, including refreshes.
+	Queries uint64
+	// Invalidations is the number of cached paths removed because an
+	// interface on the path was reported down.
+	Invalidations uint64
+}
+
+// pathCache caches the paths per destination IA.
+// The paths are re-queried in the background before they expire, as long as
+// they are used. Concurrent lookups for the same destination share a single
+// query. Paths over interfaces reported down by SCMP are removed.
+type pathCache struct {
+	querier snet.PathQuerier
+
+	mutex      sync.Mutex
+	entries    map[addr.IA]*pathCacheEntry
+	downIfaces map[ifaceKey]time.Time
+	metrics    PathCacheMetrics
+}
+
+type pathCacheEntry struct {
+	paths    []snet.Path
+	err      error // error of the last query
+	lastUsed time.Time
+	// pending is closed when the query currently in flight completes, nil if
+	// no query is in flight.
+	pending chan struct{}
+	timer   *time.Timer
+}
+
+func newPathCache(querier snet.PathQuerier) *pathCache {
+	return &pathCache{
+		querier:    querier,
+		entries:    make(map[addr.IA]*pathCacheEntry),
+		downIfaces: make(map[ifaceKey]time.Time),
+	}
+}
+
+// get returns the usable paths to ia, querying sciond if none are cached.
+func (c *pathCache) get(ctx context.Context, ia addr.IA) ([]snet.Path, error) {
+	c.mutex.Lock()
+	now := time.Now()
+	e, ok := c.entries[ia]
+	if ok {
+		e.lastUsed = now
+		if paths := c.usable(e.paths, now); len(paths) > 0 {
+			c.metrics.Hits++
+			c.mutex.Unlock()
+			return paths, nil
+		}
+	} else {
+		e = &pathCacheEntry{lastUsed: now}
+		c.entries[ia] = e
+	}
+	c.metrics.Misses++
+	pending := e.pending
+	if pending == nil {
+		pending = c.query(ia, e)
+	}
+	c.mutex.Unlock()
+
+	select {
+	case <-pending:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	paths := c.usable(e.paths, time.Now())
+	if len(paths) == 0 && e.err != nil {
+		return nil, e.err
+	}
+	return paths, nil
+}
+
+// query starts a query for the paths to ia and returns the channel closed on
+// its completion. The caller must hold the mutex.
+func (c *pathCache) query(ia addr.IA, e *pathCacheEntry) chan struct{} {
+	c.metrics.Queries++
+	e.pending = make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pathQueryTimeout)
+		defer cancel()
+		paths, err := c.querier.Query(ctx, ia)
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		e.err = err
+		if err == nil {
+			e.paths = filterDuplicates(paths)
+		}
+		close(e.pending)
+		e.pending = nil
+		if c.entries[ia] != e {
+			return // evicted meanwhile
+		}
+		if len(c.usable(e.paths, time.Now())) == 0 {
+			// nothing worth keeping, query again on next use
+			delete(c.entries, ia)
+			return
+		}
+		c.scheduleRefresh(ia, e)
+	}()
+	return e.pending
+}
+
+// scheduleRefresh schedules the next query for the paths to ia, before the
+// first path expires. The caller must hold the mutex.
+func (c *pathCache) scheduleRefresh(ia addr.IA, e *pathCacheEntry) {
+	next := pathCacheMaxAge
+	if e.err != nil {
+		next = pathRefreshRetry
+	}
+	for _, p := range e.paths {
+		if d := time.Until(p.Metadata().Expiry) - pathCacheRefreshLead; d < next {
+			next = d
+		}
+	}
+	if next < pathRefreshRetry {
+		next = pathRefreshRetry
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.timer = time.AfterFunc(next, func() { c.refresh(ia, e) })
+}
+
+// refresh queries the paths to ia again, or evicts them if they have not been
+// used recently.
+func (c *pathCache) refresh(ia addr.IA, e *pathCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries[ia] != e || e.pending != nil {
+		return
+	}
+	if time.Since(e.lastUsed) > pathCacheIdleTimeout {
+		delete(c.entries, ia)
+		return
+	}
+	c.query(ia, e)
+}
+
+// ifaceDown removes the cached paths over the interfaces and avoids them for
+// ifaceDownTimeout. Destinations with removed paths are queried again.
+func (c *pathCache) ifaceDown(ifaces []ifaceKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for _, k := range ifaces {
+		c.downIfaces[k] = now
+	}
+	for ia, e := range c.entries {
+		kept := e.paths[:0:0]
+		for _, p := range e.paths {
+			if !c.usesDownIface(p, now) {
+				kept = append(kept, p)
+			}
+		}
+		if removed := len(e.paths) - len(kept); removed > 0 {
+			c.metrics.Invalidations += uint64(removed)
+			e.paths = kept
+			if e.pending == nil {
+				c.query(ia, e)
+			}
+		}
+	}
+}
+
+// usable returns the paths that have not expired and do not use any
+// interface recently reported down. The caller must hold the mutex.
+func (c *pathCache) usable(paths []snet.Path, now time.Time) []snet.Path {
+	for k, t := range c.downIfaces {
+		if now.Sub(t) > ifaceDownTimeout {
+			delete(c.downIfaces, k)
+		}
+	}
+	usable := make([]snet.Path, 0, len(paths))
+	for _, p := range paths {
+		if p.Metadata().Expiry.After(now) && !c.usesDownIface(p, now) {
+			usable = append(usable, p)
+		}
+	}
+	return usable
+}
+
+// usesDownIface returns true if the path uses an interface recently reported
+// down. The caller must hold the mutex.
+func (c *pathCache) usesDownIface(p snet.Path, now time.Time) bool {
+	for _, intf := range p.Metadata().Interfaces {
+		if t, down := c.downIfaces[ifaceKey{intf.IA, intf.ID}]; down && now.Sub(t) <= ifaceDownTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// getMetrics returns a snapshot of the counters.
+func (c *pathCache) getMetrics() PathCacheMetrics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.metrics
+}
+
+// close stops all background refreshes.
+func (c *pathCache) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for ia, e := range c.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		delete(c.entries, ia)
+	}
+}
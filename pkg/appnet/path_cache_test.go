@@ -0,0 +1,101 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+)
+
+// countingQuerier returns fixed paths after a delay and counts the queries.
+type countingQuerier struct {
+	mutex   sync.Mutex
+	queries int
+	paths   []snet.Path
+	delay   time.Duration
+}
+
+func (q *countingQuerier) Query(ctx context.Context, dst addr.IA) ([]snet.Path, error) {
+	time.Sleep(q.delay)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.queries++
+	return q.paths, nil
+}
+
+func (q *countingQuerier) count() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.queries
+}
+
+func TestPathCache(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000110}
+	expiry := time.Now().Add(time.Hour)
+	p12 := makeTestPath(ia, 1, 2).(*snetpath.Path)
+	p12.Meta.Expiry = expiry
+	p34 := makeTestPath(ia, 3, 4).(*snetpath.Path)
+	p34.Meta.Expiry = expiry
+	querier := &countingQuerier{paths: []snet.Path{p12, p34}, delay: 10 * time.Millisecond}
+	cache := newPathCache(querier)
+	defer cache.close()
+
+	// concurrent lookups share one query
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paths, err := cache.get(context.Background(), ia)
+			if err != nil || len(paths) != 2 {
+				t.Errorf("expected 2 paths, got %v, %v", paths, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := querier.count(); n != 1 {
+		t.Errorf("expected 1 query, got %d", n)
+	}
+
+	// answered from the cache
+	if _, err := cache.get(context.Background(), ia); err != nil {
+		t.Fatal(err)
+	}
+	if n := querier.count(); n != 1 {
+		t.Errorf("expected cache hit, got %d queries", n)
+	}
+	if m := cache.getMetrics(); m.Hits+m.Misses != 6 || m.Misses == 0 || m.Queries != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+
+	// paths over interfaces reported down are removed
+	cache.ifaceDown([]ifaceKey{{ia, 2}})
+	paths, err := cache.get(context.Background(), ia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != snet.Path(p34) {
+		t.Errorf("expected only path over interfaces 3,4, got %v", paths)
+	}
+	if m := cache.getMetrics(); m.Invalidations != 1 {
+		t.Errorf("expected 1 invalidation, got %+v", m)
+	}
+}
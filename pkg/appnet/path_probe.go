@@ -0,0 +1,194 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// echoReply is an SCMP echo reply received by the echoReplyHandler.
+type echoReply struct {
+	seq      uint16
+	received time.Time
+}
+
+// echoReplyHandler is an SCMP handler passing echo replies to a channel.
+// All other SCMP messages are ignored.
+type echoReplyHandler struct {
+	replies chan<- echoReply
+}
+
+func (h echoReplyHandler) Handle(pkt *snet.Packet) error {
+	if reply, ok := pkt.Payload.(snet.SCMPEchoReply); ok {
+		select {
+		case h.replies <- echoReply{seq: reply.SeqNumber, received: time.Now()}:
+		default: // nobody waiting for replies, drop
+		}
+	}
+	return nil
+}
+
+// probeReplyBuffer is the number of echo replies buffered by an RTTProber.
+const probeReplyBuffer = 64
+
+// RTTProber measures round trip times over paths with SCMP echo requests.
+// All probes are sent from the same socket, registered once with the
+// dispatcher of the network.
+type RTTProber struct {
+	n       *Network
+	conn    snet.PacketConn
+	localIP net.IP
+	port    uint16
+	replies chan echoReply
+
+	mutex sync.Mutex // serializes Probe
+	seq   uint16
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRTTProber creates an RTTProber sending probes from this network.
+// The prober must be closed to release the socket.
+func (n *Network) NewRTTProber(ctx context.Context) (*RTTProber, error) {
+	localIP, err := n.DefaultLocalIP()
+	if err != nil {
+		return nil, err
+	}
+	replies := make(chan echoReply, probeReplyBuffer)
+	disp := &snet.DefaultPacketDispatcherService{
+		Dispatcher:  n.dispatcher,
+		SCMPHandler: echoReplyHandler{replies: replies},
+	}
+	conn, port, err := disp.Register(ctx, n.IA, &net.UDPAddr{IP: localIP}, addr.SvcNone)
+	if err != nil {
+		return nil, err
+	}
+	p := &RTTProber{
+		n:       n,
+		conn:    conn,
+		localIP: localIP,
+		port:    port,
+		replies: replies,
+		closed:  make(chan struct{}),
+	}
+	go p.read()
+	return p, nil
+}
+
+// read drives the SCMP handler until the prober is closed; no other packets
+// are expected.
+func (p *RTTProber) read() {
+	for {
+		var pkt snet.Packet
+		var ov net.UDPAddr
+		if err := p.conn.ReadFrom(&pkt, &ov); err != nil {
+			select {
+			case <-p.closed:
+				return
+			default:
+			}
+			if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+				return
+			}
+		}
+	}
+}
+
+// Probe measures the round trip time over each of the paths to dst, with
+// SCMP echo requests to the destination host.
+// The result contains the RTTs for the paths for which a reply was received
+// before the timeout. Replies to earlier probes are ignored.
+func (p *RTTProber) Probe(dst *snet.UDPAddr, paths []snet.Path, timeout time.Duration) (map[snet.PathFingerprint]time.Duration, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// discard late replies to the previous probes
+	for len(p.replies) > 0 {
+		<-p.replies
+	}
+	base := p.seq
+	p.seq += uint16(len(paths))
+
+	sent := make([]time.Time, len(paths))
+	for i, path := range paths {
+		pkt := &snet.Packet{
+			PacketInfo: snet.PacketInfo{
+				Destination: snet.SCIONAddress{IA: dst.IA, Host: addr.HostFromIP(dst.Host.IP)},
+				Source:      snet.SCIONAddress{IA: p.n.IA, Host: addr.HostFromIP(p.localIP)},
+				Path:        path.Path(),
+				Payload: snet.SCMPEchoRequest{
+					Identifier: p.port,
+					SeqNumber:  base + uint16(i),
+				},
+			},
+		}
+		sent[i] = time.Now()
+		if err := p.conn.WriteTo(pkt, path.UnderlayNextHop()); err != nil {
+			return nil, err
+		}
+	}
+
+	rtts := make(map[snet.PathFingerprint]time.Duration, len(paths))
+	for len(rtts) < len(paths) {
+		select {
+		case r := <-p.replies:
+			if i := int(r.seq - base); i < len(paths) {
+				rtts[snet.Fingerprint(paths[i])] = r.received.Sub(sent[i])
+			}
+		case <-ctx.Done():
+			return rtts, nil
+		}
+	}
+	return rtts, nil
+}
+
+// Close releases the socket of the prober.
+func (p *RTTProber) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return p.conn.Close()
+}
+
+// ProbeRTTs measures the round trip time over each of the paths to dst, with
+// SCMP echo requests to the destination host, on the default network.
+// The result contains the RTTs for the paths for which a reply was received
+// before the timeout.
+func ProbeRTTs(dst *snet.UDPAddr, paths []snet.Path, timeout time.Duration) (map[snet.PathFingerprint]time.Duration, error) {
+	return DefNetwork().ProbeRTTs(dst, paths, timeout)
+}
+
+// ProbeRTTs measures the round trip time over each of the paths to dst, with
+// SCMP echo requests to the destination host, from a temporary RTTProber.
+// The result contains the RTTs for the paths for which a reply was received
+// before the timeout.
+func (n *Network) ProbeRTTs(dst *snet.UDPAddr, paths []snet.Path, timeout time.Duration) (map[snet.PathFingerprint]time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p, err := n.NewRTTProber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+	return p.Probe(dst, paths, timeout)
+}
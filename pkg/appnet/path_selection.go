@@ -15,21 +15,19 @@
 package appnet
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"math"
-	"os"
-	"regexp"
-	"strconv"
+	"time"
 
-	"github.com/bclicn/color"
 	log "github.com/inconshreveable/log15"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/spath"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 )
 
 // metrics for path selection
@@ -37,8 +35,32 @@ const (
 	PathAlgoDefault = iota // default algorithm
 	MTU                    // metric for path with biggest MTU
 	Shortest               // metric for shortest path
+	Latency                // metric for path with lowest latency
+	Bandwidth              // metric for path with highest bottleneck bandwidth
+	Weighted               // weighted combination of all metrics, see DefaultPathWeights
 )
 
+// PathWeights are the weights of the individual path metrics in the score
+// used by the Weighted path selection algorithm.
+type PathWeights struct {
+	Hops      float64
+	MTU       float64
+	Latency   float64
+	Bandwidth float64
+}
+
+// DefaultPathWeights are the weights used for the Weighted path selection algorithm.
+var DefaultPathWeights = PathWeights{
+	Hops:      1,
+	MTU:       1,
+	Latency:   2,
+	Bandwidth: 2,
+}
+
+// rttProbeTimeout is the time to wait for replies to SCMP echo requests in
+// ChoosePathByMetricProbed.
+const rttProbeTimeout = 1 * time.Second
+
 // ChoosePathInteractive presents the user a selection of paths to choose from.
 // If the remote address is in the local IA, return (nil, nil), without prompting the user.
 func ChoosePathInteractive(dst addr.IA) (snet.Path, error) {
@@ -47,28 +69,7 @@ func ChoosePathInteractive(dst addr.IA) (snet.Path, error) {
 	if err != nil || len(paths) == 0 {
 		return nil, err
 	}
-
-	fmt.Printf("Available paths to %v\n", dst)
-	for i, path := range paths {
-		fmt.Printf("[%2d] %s\n", i, fmt.Sprintf("%s", path))
-	}
-
-	var selectedPath snet.Path
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Printf("Choose path: ")
-		scanner.Scan()
-		pathIndexStr := scanner.Text()
-		pathIndex, err := strconv.Atoi(pathIndexStr)
-		if err == nil && 0 <= pathIndex && pathIndex < len(paths) {
-			selectedPath = paths[pathIndex]
-			break
-		}
-		fmt.Printf("ERROR: Invalid path index %v, valid indices range: [0, %v]\n", pathIndex, len(paths)-1)
-	}
-	re := regexp.MustCompile(`\d{1,4}-([0-9a-f]{1,4}:){2}[0-9a-f]{1,4}`)
-	fmt.Printf("Using path:\n %s\n", re.ReplaceAllStringFunc(fmt.Sprintf("%s", selectedPath), color.Cyan))
-	return selectedPath, nil
+	return pathselection.Prompt(paths)
 }
 
 // ChoosePathByMetric chooses the best path based on the metric pathAlgo
@@ -79,7 +80,30 @@ func ChoosePathByMetric(pathAlgo int, dst addr.IA) (snet.Path, error) {
 	if err != nil || len(paths) == 0 {
 		return nil, err
 	}
-	return pathSelection(paths, pathAlgo), nil
+	return pathSelection(paths, pathAlgo, nil), nil
+}
+
+// ChoosePathByMetricProbed chooses the best path to dst based on the metric
+// pathAlgo, analogous to ChoosePathByMetric.
+// For the Latency and Weighted metrics, the round trip time over each path is
+// measured with SCMP echo requests to the destination host. The measured
+// latency is used instead of the static latency information from the path
+// metadata for all paths for which a reply was received.
+// If the remote address is in the local IA, return (nil, nil).
+func ChoosePathByMetricProbed(pathAlgo int, dst *snet.UDPAddr) (snet.Path, error) {
+
+	paths, err := QueryPaths(dst.IA)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	var rtts map[snet.PathFingerprint]time.Duration
+	if pathAlgo == Latency || pathAlgo == Weighted {
+		rtts, err = ProbeRTTs(dst, paths, rttProbeTimeout)
+		if err != nil {
+			log.Debug("Path RTT probing failed, using static latency", "err", err)
+		}
+	}
+	return pathSelection(paths, pathAlgo, rtts), nil
 }
 
 // SetPath is a helper function to set the path on an snet.UDPAddr
@@ -93,10 +117,30 @@ func SetPath(addr *snet.UDPAddr, path snet.Path) {
 	}
 }
 
+// SelectPath sets the path chosen by selector out of the paths returned by a
+// query to sciond.
+// This is a no-op if remote is in the local AS.
+func SelectPath(addr *snet.UDPAddr, selector pathselection.Selector) error {
+	paths, err := QueryPaths(addr.IA)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	path, err := selector.Select(paths)
+	if err != nil {
+		return err
+	}
+	SetPath(addr, path)
+	return nil
+}
+
 // SetDefaultPath sets the first path returned by a query to sciond.
 // This is a no-op if if remote is in the local AS.
 func SetDefaultPath(addr *snet.UDPAddr) error {
-	paths, err := QueryPaths(addr.IA)
+	return DefNetwork().setDefaultPath(context.Background(), addr)
+}
+
+func (n *Network) setDefaultPath(ctx context.Context, addr *snet.UDPAddr) error {
+	paths, err := n.QueryPathsContext(ctx, addr.IA)
 	if err != nil || len(paths) == 0 {
 		return err
 	}
@@ -106,22 +150,54 @@ func SetDefaultPath(addr *snet.UDPAddr) error {
 
 // QueryPaths queries the DefNetwork's sciond PathQuerier connection for paths to addr
 // If addr is in the local IA, an empty slice and no error is returned.
+// The paths are cached, see QueryPathsContext.
 func QueryPaths(ia addr.IA) ([]snet.Path, error) {
-	if ia == DefNetwork().IA {
+	return QueryPathsContext(context.Background(), ia)
+}
+
+// QueryPathsContext queries paths to ia, analogous to QueryPaths.
+// The context bounds the query to sciond.
+func QueryPathsContext(ctx context.Context, ia addr.IA) ([]snet.Path, error) {
+	n, err := defNetworkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return n.QueryPathsContext(ctx, ia)
+}
+
+// QueryPaths queries the paths to ia in this network. See the package level
+// QueryPaths.
+func (n *Network) QueryPaths(ia addr.IA) ([]snet.Path, error) {
+	return n.QueryPathsContext(context.Background(), ia)
+}
+
+// QueryPathsContext queries the Network's sciond PathQuerier connection for
+// paths to ia. See the package level QueryPathsContext.
+//
+// The paths are cached per destination. Cached paths are refreshed in the
+// background before they expire, as long as they are used, and paths over
+// interfaces reported down by SCMP are removed. Only unexpired paths are
+// returned.
+func (n *Network) QueryPathsContext(ctx context.Context, ia addr.IA) ([]snet.Path, error) {
+	if ia == n.IA {
 		return nil, nil
 	} else {
-		paths, err := DefNetwork().PathQuerier.Query(context.Background(), ia)
+		paths, err := n.pathCache.get(ctx, ia)
 		if err != nil {
 			return nil, err
 		}
 		if len(paths) == 0 {
 			return nil, errors.New("no path available")
 		}
-		paths = filterDuplicates(paths)
 		return paths, nil
 	}
 }
 
+// PathCacheMetrics returns the counters of the path cache of the Network.
+func (n *Network) PathCacheMetrics() PathCacheMetrics {
+	return n.pathCache.getMetrics()
+}
+
 // filterDuplicates filters paths with identical sequence of interfaces.
 // These duplicates occur because sciond may return the same "effective" path with
 // different short-cut "upstream" parts.
@@ -152,12 +228,15 @@ func filterDuplicates(paths []snet.Path) []snet.Path {
 	return filtered
 }
 
-func pathSelection(paths []snet.Path, pathAlgo int) snet.Path {
+// pathSelection selects a path using the metric pathAlgo. rtts optionally
+// contains measured round trip times for (some of) the paths.
+func pathSelection(paths []snet.Path, pathAlgo int, rtts map[snet.PathFingerprint]time.Duration) snet.Path {
 	var selectedPath snet.Path
 	var metric float64
 	// A path selection algorithm consists of a simple comparison function selecting the best path according
 	// to some path property and a metric function normalizing that property to a value in [0,1], where larger is better
-	// Available path selection algorithms, the metric returned must be normalized between [0,1]:
+	// Available path selection algorithms, the metric returned must be normalized between [0,1].
+	// The default algorithm only considers these, Latency and Bandwidth must be selected explicitly:
 	pathAlgos := map[int](func([]snet.Path) (snet.Path, float64)){
 		Shortest: selectShortestPath,
 		MTU:      selectLargestMTUPath,
@@ -169,6 +248,15 @@ func pathSelection(paths []snet.Path, pathAlgo int) snet.Path {
 	case MTU:
 		log.Debug("Path selection algorithm", "pathAlgo", "MTU")
 		selectedPath, metric = pathAlgos[pathAlgo](paths)
+	case Latency:
+		log.Debug("Path selection algorithm", "pathAlgo", "latency", "probed", len(rtts))
+		selectedPath, metric = selectLowestLatencyPath(paths, rtts)
+	case Bandwidth:
+		log.Debug("Path selection algorithm", "pathAlgo", "bandwidth")
+		selectedPath, metric = selectHighestBandwidthPath(paths)
+	case Weighted:
+		log.Debug("Path selection algorithm", "pathAlgo", "weighted", "probed", len(rtts))
+		selectedPath, metric = selectWeightedPath(paths, rtts, DefaultPathWeights)
 	default:
 		// Default is to take result with best score
 		for _, algo := range pathAlgos {
@@ -185,33 +273,95 @@ func pathSelection(paths []snet.Path, pathAlgo int) snet.Path {
 
 func selectShortestPath(paths []snet.Path) (selectedPath snet.Path, metric float64) {
 	// Selects shortest path by number of hops
+	selectedPath, _ = pathselection.Shortest().Select(paths)
+	return selectedPath, hopsMetric(selectedPath)
+}
+
+func selectLargestMTUPath(paths []snet.Path) (selectedPath snet.Path, metric float64) {
+	// Selects path with largest MTU
+	selectedPath, _ = pathselection.LargestMTU().Select(paths)
+	return selectedPath, mtuMetric(selectedPath)
+}
+
+func selectLowestLatencyPath(paths []snet.Path, rtts map[snet.PathFingerprint]time.Duration) (selectedPath snet.Path, metric float64) {
+	// Selects path with lowest latency, i.e. the best latency metric
 	for _, path := range paths {
-		if selectedPath == nil || len(path.Metadata().Interfaces) < len(selectedPath.Metadata().Interfaces) {
-			selectedPath = path
+		m := latencyMetric(path, rtts)
+		if selectedPath == nil || m > metric {
+			selectedPath, metric = path, m
 		}
 	}
-	metricFn := func(rawMetric int) (result float64) {
-		hopCount := float64(rawMetric)
-		midpoint := 7.0
-		result = math.Exp(-(hopCount - midpoint)) / (1 + math.Exp(-(hopCount - midpoint)))
-		return result
-	}
-	return selectedPath, metricFn(len(selectedPath.Metadata().Interfaces))
+	return selectedPath, metric
 }
 
-func selectLargestMTUPath(paths []snet.Path) (selectedPath snet.Path, metric float64) {
-	// Selects path with largest MTU
+func selectHighestBandwidthPath(paths []snet.Path) (selectedPath snet.Path, metric float64) {
+	// Selects path with highest bottleneck bandwidth
+	selectedPath, _ = pathselection.HighestBandwidth().Select(paths)
+	return selectedPath, bandwidthMetric(selectedPath)
+}
+
+func selectWeightedPath(paths []snet.Path, rtts map[snet.PathFingerprint]time.Duration,
+	weights PathWeights) (selectedPath snet.Path, metric float64) {
+	// Selects path with the best weighted average of all metrics
+	total := weights.Hops + weights.MTU + weights.Latency + weights.Bandwidth
+	if total <= 0 {
+		return paths[0], 0
+	}
 	for _, path := range paths {
-		if selectedPath == nil || path.Metadata().MTU > selectedPath.Metadata().MTU {
-			selectedPath = path
+		m := (weights.Hops*hopsMetric(path) +
+			weights.MTU*mtuMetric(path) +
+			weights.Latency*latencyMetric(path, rtts) +
+			weights.Bandwidth*bandwidthMetric(path)) / total
+		if selectedPath == nil || m > metric {
+			selectedPath, metric = path, m
 		}
 	}
-	metricFn := func(rawMetric uint16) (result float64) {
-		mtu := float64(rawMetric)
-		midpoint := 1500.0
-		tilt := 0.004
-		result = 1 / (1 + math.Exp(-tilt*(mtu-midpoint)))
-		return result
+	return selectedPath, metric
+}
+
+// hopsMetric normalizes the number of hops of the path to [0,1]
+func hopsMetric(path snet.Path) float64 {
+	hopCount := float64(len(path.Metadata().Interfaces))
+	midpoint := 7.0
+	return math.Exp(-(hopCount - midpoint)) / (1 + math.Exp(-(hopCount - midpoint)))
+}
+
+// mtuMetric normalizes the MTU of the path to [0,1]
+func mtuMetric(path snet.Path) float64 {
+	mtu := float64(path.Metadata().MTU)
+	midpoint := 1500.0
+	tilt := 0.004
+	return 1 / (1 + math.Exp(-tilt*(mtu-midpoint)))
+}
+
+// latencyMetric normalizes the one-way latency of the path to [0,1].
+// The latency is taken as half of the measured round trip time, if available
+// in rtts, or otherwise from the static path metadata.
+// Paths with unknown latency get metric 0.
+func latencyMetric(path snet.Path, rtts map[snet.PathFingerprint]time.Duration) float64 {
+	latency, known := pathselection.Latency(path)
+	if rtt, ok := rtts[snet.Fingerprint(path)]; ok {
+		latency, known = rtt/2, true
+	}
+	if !known {
+		return 0
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	midpoint := 100.0
+	tilt := 0.05
+	return 1 / (1 + math.Exp(tilt*(ms-midpoint)))
+}
+
+// bandwidthMetric normalizes the bottleneck bandwidth of the path to [0,1],
+// on a logarithmic scale.
+// Paths with unknown bandwidth get metric 0.
+func bandwidthMetric(path snet.Path) float64 {
+	bw := pathselection.Bandwidth(path)
+	if bw == 0 {
+		return 0
 	}
-	return selectedPath, metricFn(selectedPath.Metadata().MTU)
+	logKbps := math.Log10(float64(bw))
+	midpoint := 5.0 // 100 Mbit/s
+	tilt := 2.0
+	return 1 / (1 + math.Exp(-tilt*(logKbps-midpoint)))
 }
@@ -0,0 +1,126 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+)
+
+var (
+	ia1 = addr.IA{I: 1, A: 0xff0000000111}
+	ia2 = addr.IA{I: 1, A: 0xff0000000112}
+	ia3 = addr.IA{I: 1, A: 0xff0000000113}
+)
+
+// newMetricsTopology returns a topology with a short, slow and narrow path
+// from ia1 to ia2 and a longer, fast and wide path via ia3.
+func newMetricsTopology() (topo *appnettest.Topology, direct, via snet.Path) {
+	topo = appnettest.NewTopology()
+	topo.AddLink(ia1, 1, ia2, 1).SetLatency(50 * time.Millisecond).SetBandwidth(1000)
+	topo.AddLink(ia1, 2, ia3, 1).SetLatency(1 * time.Millisecond).SetBandwidth(100000000)
+	topo.AddLink(ia3, 2, ia2, 2).SetLatency(1 * time.Millisecond).SetBandwidth(100000000)
+	topo.SetDefault(ia1)
+	paths := topo.Paths(ia1, ia2)
+	return topo, paths[0], paths[1]
+}
+
+func TestChoosePathByMetric(t *testing.T) {
+	_, direct, via := newMetricsTopology()
+
+	cases := []struct {
+		name     string
+		pathAlgo int
+		expected snet.Path
+	}{
+		// the default only considers hops and MTU, not the better bandwidth
+		// and latency of the longer path
+		{"default", appnet.PathAlgoDefault, direct},
+		{"shortest", appnet.Shortest, direct},
+		{"latency", appnet.Latency, via},
+		{"bandwidth", appnet.Bandwidth, via},
+		{"weighted", appnet.Weighted, via},
+	}
+	for _, c := range cases {
+		actual, err := appnet.ChoosePathByMetric(c.pathAlgo, ia2)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if snet.Fingerprint(actual) != snet.Fingerprint(c.expected) {
+			t.Errorf("%s: expected path %v, got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestChoosePathByMetricProbed(t *testing.T) {
+	topo, direct, via := newMetricsTopology()
+
+	ctx := context.Background()
+	server, err := topo.Network(ia2).ListenContext(ctx, &net.UDPAddr{IP: appnettest.HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	dst := &snet.UDPAddr{IA: ia2, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: 1234}}
+
+	rtts, err := appnet.ProbeRTTs(dst, []snet.Path{direct, via}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtt, ok := rtts[snet.Fingerprint(direct)]; !ok || rtt < 100*time.Millisecond {
+		t.Errorf("expected RTT of at least 100ms over the direct path, got %v (%v)", rtt, ok)
+	}
+	if rtt, ok := rtts[snet.Fingerprint(via)]; !ok || rtt >= 100*time.Millisecond {
+		t.Errorf("expected RTT below 100ms over the path via %s, got %v (%v)", ia3, rtt, ok)
+	}
+
+	actual, err := appnet.ChoosePathByMetricProbed(appnet.Latency, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snet.Fingerprint(actual) != snet.Fingerprint(via) {
+		t.Errorf("expected path via %s, got %v", ia3, actual)
+	}
+}
+
+func TestProbeRTTsNetwork(t *testing.T) {
+	topo, _, _ := newMetricsTopology()
+
+	// Probe from ia2, which is not the default network
+	ctx := context.Background()
+	server, err := topo.Network(ia1).ListenContext(ctx, &net.UDPAddr{IP: appnettest.HostIP, Port: 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	dst := &snet.UDPAddr{IA: ia1, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: 1234}}
+
+	paths := topo.Paths(ia2, ia1)
+	rtts, err := topo.Network(ia2).ProbeRTTs(dst, paths, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rtts) != len(paths) {
+		t.Errorf("expected RTTs for all %d paths, got %v", len(paths), rtts)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/slayers/path/scion"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+const (
+	// LocalMTU is the MTU assumed for traffic within the local AS, for which
+	// there is no path metadata.
+	LocalMTU = 1472
+	// pmtuTimeout is the time after which an MTU learned from an SCMP packet
+	// too big message is forgotten, so that an increased MTU is noticed.
+	pmtuTimeout = 10 * time.Minute
+
+	// Fixed header lengths, in bytes, used to compute the payload size.
+	scionCommonHdrLen = 12
+	scionAddrHdrLen   = 16 // source and destination IA, without host addresses
+	udpHdrLen         = 8
+)
+
+// pmtuTable records path MTUs learned from SCMP packet too big messages.
+type pmtuTable struct {
+	mutex   sync.Mutex
+	entries map[string]pmtuEntry
+}
+
+type pmtuEntry struct {
+	mtu     uint16
+	learned time.Time
+}
+
+func newPMTUTable() *pmtuTable {
+	return &pmtuTable{entries: make(map[string]pmtuEntry)}
+}
+
+// learn records the MTU reported for the path.
+func (t *pmtuTable) learn(p spath.Path, mtu uint16) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	for k, e := range t.entries {
+		if now.Sub(e.learned) > pmtuTimeout {
+			delete(t.entries, k)
+		}
+	}
+	key := pathKey(p)
+	if e, ok := t.entries[key]; ok && e.mtu < mtu && now.Sub(e.learned) <= pmtuTimeout {
+		return
+	}
+	t.entries[key] = pmtuEntry{mtu: mtu, learned: now}
+}
+
+// get returns the MTU learned for the path, if any.
+func (t *pmtuTable) get(p spath.Path) (uint16, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	e, ok := t.entries[pathKey(p)]
+	if !ok || time.Since(e.learned) > pmtuTimeout {
+		return 0, false
+	}
+	return e.mtu, true
+}
+
+// pathKey identifies a SCION path by its sequence of hop field interfaces,
+// which, unlike the raw path, is not modified by the routers forwarding a
+// packet.
+func pathKey(p spath.Path) string {
+	if p.Type != scion.PathType {
+		return string(p.Raw)
+	}
+	var decoded scion.Decoded
+	if err := decoded.DecodeFromBytes(p.Raw); err != nil {
+		return string(p.Raw)
+	}
+	key := make([]byte, 0, 3+4*decoded.NumHops)
+	key = append(key, decoded.PathMeta.SegLen[:]...)
+	for i := 0; i < decoded.NumHops; i++ {
+		hf := decoded.HopFields[i]
+		key = append(key, 0, 0, 0, 0)
+		binary.BigEndian.PutUint16(key[len(key)-4:], hf.ConsIngress)
+		binary.BigEndian.PutUint16(key[len(key)-2:], hf.ConsEgress)
+	}
+	return string(key)
+}
+
+// PathMTU returns the MTU of the path in the default Network, see
+// Network.PathMTU.
+func PathMTU(path snet.Path) int {
+	return DefNetwork().PathMTU(path)
+}
+
+// PathMTU returns the MTU of the path, i.e. the maximum size of SCION packets
+// sent over it. This is the MTU from the path metadata, or the smaller MTU
+// reported by an SCMP packet too big message for this path.
+// For a nil path, i.e. within the local AS, LocalMTU is returned.
+func (n *Network) PathMTU(path snet.Path) int {
+	if path == nil {
+		return LocalMTU
+	}
+	mtu := LocalMTU
+	if meta := path.Metadata(); meta != nil && meta.MTU != 0 {
+		mtu = int(meta.MTU)
+	}
+	if learned, ok := n.pmtu.get(path.Path()); ok && int(learned) < mtu {
+		mtu = int(learned)
+	}
+	return mtu
+}
+
+// MaxPayloadSize returns the maximum size of the payload of a SCION/UDP packet
+// sent over path in the default Network, i.e. the path MTU less the SCION and
+// UDP headers. IPv6 host addresses are assumed, so the result is conservative
+// for IPv4 hosts.
+func MaxPayloadSize(path snet.Path) int {
+	return DefNetwork().MaxPayloadSize(path)
+}
+
+// MaxPayloadSize returns the maximum size of the payload of a SCION/UDP packet
+// sent over path in this network. See the package level MaxPayloadSize.
+func (n *Network) MaxPayloadSize(path snet.Path) int {
+	var sp spath.Path
+	if path != nil {
+		sp = path.Path()
+	}
+	return payloadSize(n.PathMTU(path), sp, net.IPv6zero, net.IPv6zero)
+}
+
+// payloadSize returns the maximum UDP payload of a packet of size mtu between
+// the hosts src and dst over the path.
+func payloadSize(mtu int, path spath.Path, src, dst net.IP) int {
+	size := mtu - scionCommonHdrLen - scionAddrHdrLen - hostAddrLen(src) - hostAddrLen(dst) -
+		len(path.Raw) - udpHdrLen
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+func hostAddrLen(ip net.IP) int {
+	if ip.To4() != nil {
+		return net.IPv4len
+	}
+	return net.IPv6len
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+func TestPathMTU(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000110}
+	p12 := makeTestPath(ia, 1, 2).(*snetpath.Path)
+	p12.Meta.MTU = 1400
+	p12.SPath = spath.Path{Raw: make([]byte, 64)}
+	p34 := makeTestPath(ia, 3, 4).(*snetpath.Path)
+	p34.SPath = spath.Path{Raw: make([]byte, 80)}
+
+	n := &Network{pmtu: newPMTUTable()}
+	if mtu := n.PathMTU(nil); mtu != LocalMTU {
+		t.Errorf("expected local MTU %d, got %d", LocalMTU, mtu)
+	}
+	if mtu := n.PathMTU(p12); mtu != 1400 {
+		t.Errorf("expected MTU from metadata, got %d", mtu)
+	}
+	if mtu := n.PathMTU(p34); mtu != LocalMTU {
+		t.Errorf("expected local MTU without metadata, got %d", mtu)
+	}
+
+	// packet too big lowers the MTU of the path, but never raises it
+	n.pmtu.learn(p12.SPath, 1300)
+	n.pmtu.learn(p12.SPath, 1350)
+	if mtu := n.PathMTU(p12); mtu != 1300 {
+		t.Errorf("expected learned MTU 1300, got %d", mtu)
+	}
+	if mtu := n.PathMTU(p34); mtu != LocalMTU {
+		t.Errorf("expected other path unaffected, got %d", mtu)
+	}
+
+	// 12 common header + 16 IAs + 4+16 hosts + 64 path + 8 UDP
+	if size := payloadSize(1400, p12.SPath, net.IPv4(127, 0, 0, 1), net.IPv6loopback); size != 1280 {
+		t.Errorf("expected payload size 1280, got %d", size)
+	}
+}
@@ -17,6 +17,7 @@
 package appnet
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -29,22 +30,54 @@ import (
 
 const rainsConfigPath = "/etc/scion/rains.cfg"
 
+// rainsAnswerTTL is the validity assumed for addresses returned by RAINS.
+// rains.Query does not expose the validity of the assertions it returns.
+const rainsAnswerTTL = 5 * time.Minute
+
 func init() {
-	resolveRains = &rainsResolver{}
+	resolveRains = &rainsResolver{timeout: rainsDefaultTimeout}
+	newRainsResolver = func(server *snet.UDPAddr, timeout time.Duration) Resolver {
+		return &rainsResolver{server: server, timeout: timeout}
+	}
 }
 
-type rainsResolver struct{}
+type rainsResolver struct {
+	// server is the RAINS server to query. If nil, the server is read from
+	// rainsConfigPath for every query.
+	server  *snet.UDPAddr
+	timeout time.Duration
+}
 
 func (r *rainsResolver) Resolve(name string) (*snet.SCIONAddress, error) {
-	server, err := readRainsConfig()
-	if err != nil {
-		return nil, err
+	return r.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext implements ContextResolver.
+func (r *rainsResolver) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	server := r.server
+	if server == nil {
+		var err error
+		server, err = readRainsConfig()
+		if err != nil {
+			return nil, err
+		}
 	}
 	if server == nil {
 		// nobody to ask, so we won't get a reply
 		return nil, &HostNotFoundError{name}
 	}
-	return rainsQuery(server, name)
+	return rainsQuery(ctx, server, name, r.timeout)
+}
+
+// ResolveCacheable implements CacheableResolver.
+func (r *rainsResolver) ResolveCacheable(ctx context.Context,
+	name string) (*snet.SCIONAddress, time.Time, error) {
+
+	addr, err := r.ResolveContext(ctx, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return addr, time.Now().Add(rainsAnswerTTL), nil
 }
 
 func readRainsConfig() (*snet.UDPAddr, error) {
@@ -61,22 +94,33 @@ func readRainsConfig() (*snet.UDPAddr, error) {
 	return address, nil
 }
 
-func rainsQuery(server *snet.UDPAddr, hostname string) (*snet.SCIONAddress, error) {
+func rainsQuery(ctx context.Context, server *snet.UDPAddr, hostname string,
+	timeout time.Duration) (*snet.SCIONAddress, error) {
 
 	const (
-		ctx     = "."                    // use global context
-		qType   = rains.OTScionAddr      // request SCION addresses
-		expire  = 5 * time.Minute        // sensible expiry date?
-		timeout = 500 * time.Millisecond // timeout for query
+		rainsCtx = "."               // use global context
+		qType    = rains.OTScionAddr // request SCION addresses
+		expire   = 5 * time.Minute   // sensible expiry date?
 	)
 	qOpts := []rains.Option{} // no options
 
+	// rains.Query does not take a context; bound the timeout by its deadline
+	qTimeout := timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < qTimeout {
+			qTimeout = remaining
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// TODO(matzf): check that this behaves as expected:
 	// - return error on timeout, network problems, invalid format, ...
 	// - return HostNotFoundError error if all went well, but host not found
 	// TODO(chaehni): This call can sometimes cause a timeout even though the server is reachable (see issue #221)
-	// The timeout value has been decreased to counter this behavior until the problem is resolved.
-	reply, err := rains.Query(hostname, ctx, []rains.Type{qType}, qOpts, expire, timeout, server)
+	// The default timeout value has been decreased to counter this behavior until the problem is resolved.
+	reply, err := rains.Query(hostname, rainsCtx, []rains.Type{qType}, qOpts, expire, qTimeout, server)
 	if err != nil {
 		return nil, fmt.Errorf("address for host %q not found: %v", hostname, err)
 	}
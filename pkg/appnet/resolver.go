@@ -15,8 +15,10 @@
 package appnet
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/snet"
 )
@@ -30,6 +32,35 @@ type Resolver interface {
 	Resolve(name string) (*snet.SCIONAddress, error)
 }
 
+// ContextResolver is a Resolver whose lookups can be bounded by a context.
+// All Resolvers of this package implement it.
+type ContextResolver interface {
+	Resolver
+	// ResolveContext acts like Resolve. The context bounds the time spent for
+	// the lookup.
+	ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error)
+}
+
+// CacheableResolver is a Resolver that also reports how long its answers
+// are valid, see CachingResolver.
+type CacheableResolver interface {
+	Resolver
+	// ResolveCacheable acts like Resolve, but additionally returns the time
+	// until which the answer, or the HostNotFoundError, is valid. The zero
+	// time means the validity is not known.
+	ResolveCacheable(ctx context.Context, name string) (*snet.SCIONAddress, time.Time, error)
+}
+
+// ReverseResolver is the interface to find the host names of a SCION host
+// address. This is implemented for hosts files and static entries; RAINS and
+// DNS TXT records do not support reverse lookups.
+type ReverseResolver interface {
+	// ResolveAddr finds the names for the address.
+	// Returns a HostNotFoundError if no name was found, but otherwise no error
+	// occurred.
+	ResolveAddr(ctx context.Context, address snet.SCIONAddress) ([]string, error)
+}
+
 // HostNotFoundError is returned by a Resolver when the name was not found, but
 // otherwise no error occurred.
 type HostNotFoundError struct {
@@ -42,20 +73,105 @@ func (e *HostNotFoundError) Error() string {
 
 // ResolverList represents a list of Resolvers that are processed in sequence
 // to return the first match.
+// A transient DNS failure, e.g. an unreachable DNS server, does not stop the
+// lookup: the later resolvers are still consulted, and the DNS error is only
+// returned if none of them knows the name.
 type ResolverList []Resolver
 
 func (resolvers ResolverList) Resolve(name string) (*snet.SCIONAddress, error) {
+	return resolvers.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext implements ContextResolver.
+func (resolvers ResolverList) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	addr, _, err := resolvers.ResolveCacheable(ctx, name)
+	return addr, err
+}
+
+// ResolveCacheable implements CacheableResolver. The answer is valid until
+// the earliest expiry reported by any of the resolvers consulted.
+func (resolvers ResolverList) ResolveCacheable(ctx context.Context,
+	name string) (*snet.SCIONAddress, time.Time, error) {
 
 	var errHostNotFound *HostNotFoundError
+	var errTransient error
+	var expiry time.Time
 	for _, resolver := range resolvers {
+		if err := ctx.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
 		if resolver != nil {
-			addr, err := resolver.Resolve(name)
+			addr, exp, err := resolveCacheable(ctx, resolver, name)
+			if !exp.IsZero() && (expiry.IsZero() || exp.Before(expiry)) {
+				expiry = exp
+			}
 			if err == nil {
-				return addr, nil
+				return addr, expiry, nil
+			} else if isTransientDNSError(err) && ctx.Err() == nil {
+				if errTransient == nil {
+					errTransient = err
+				}
 			} else if !errors.As(err, &errHostNotFound) {
-				return addr, err
+				return addr, time.Time{}, err
 			}
 		}
 	}
-	return nil, &HostNotFoundError{name}
+	if errTransient != nil {
+		return nil, time.Time{}, errTransient
+	}
+	return nil, expiry, &HostNotFoundError{name}
+}
+
+// resolveCacheable resolves the name with resolver, including the validity of
+// the answer if resolver is a CacheableResolver.
+func resolveCacheable(ctx context.Context, resolver Resolver,
+	name string) (*snet.SCIONAddress, time.Time, error) {
+
+	if c, ok := resolver.(CacheableResolver); ok {
+		return c.ResolveCacheable(ctx, name)
+	}
+	addr, err := resolveContext(ctx, resolver, name)
+	return addr, time.Time{}, err
+}
+
+// resolveContext resolves the name with resolver, bounded by ctx if resolver
+// is a ContextResolver. Other resolvers are only called if ctx is not done.
+func resolveContext(ctx context.Context, resolver Resolver, name string) (*snet.SCIONAddress, error) {
+	if r, ok := resolver.(ContextResolver); ok {
+		return r.ResolveContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return resolver.Resolve(name)
+}
+
+// ResolveAddr implements ReverseResolver, returning the names found by the
+// first ReverseResolver in the list that knows the address.
+func (resolvers ResolverList) ResolveAddr(ctx context.Context,
+	address snet.SCIONAddress) ([]string, error) {
+
+	var errHostNotFound *HostNotFoundError
+	var errTransient error
+	for _, resolver := range resolvers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if reverse, ok := resolver.(ReverseResolver); ok {
+			names, err := reverse.ResolveAddr(ctx, address)
+			if err == nil {
+				return names, nil
+			} else if isTransientDNSError(err) && ctx.Err() == nil {
+				if errTransient == nil {
+					errTransient = err
+				}
+			} else if !errors.As(err, &errHostNotFound) {
+				return nil, err
+			}
+		}
+	}
+	if errTransient != nil {
+		return nil, errTransient
+	}
+	return nil, &HostNotFoundError{address.String()}
 }
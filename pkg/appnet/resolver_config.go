@@ -0,0 +1,236 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// EnvResolverConfig is the environment variable overriding the path of the
+	// resolver configuration file.
+	EnvResolverConfig = "SCION_RESOLV_CONF"
+	// resolverConfigPath is the default path of the resolver configuration
+	// file.
+	resolverConfigPath = "/etc/scion/resolv.conf"
+	// rainsDefaultTimeout is the timeout for RAINS queries, unless configured
+	// otherwise.
+	rainsDefaultTimeout = 500 * time.Millisecond
+)
+
+type resolverKind int
+
+const (
+	kindHosts resolverKind = iota
+	kindRains
+	kindDNS
+)
+
+type resolverEntry struct {
+	kind     resolverKind
+	resolver Resolver
+}
+
+// cachedEntry returns the entry for a RAINS or DNS resolver, caching its
+// answers. Hosts files and static entries are not cached; they are consulted
+// first on every lookup, so that changes to the hosts files take effect
+// without waiting for cached RAINS or DNS answers to expire.
+func cachedEntry(kind resolverKind, resolver Resolver) resolverEntry {
+	return resolverEntry{kind, NewCachingResolver(resolver)}
+}
+
+// resolverConfig is the list of sources used by DefaultResolver.
+//
+// It is read from a file with one directive per line; the resolvers are
+// consulted in the order of the directives, after the static entries.
+//
+//	# comment
+//	hosts <path>                     hosts file
+//	rains <address> [timeout=<dur>]  RAINS server, e.g. 19-ffaa:0:1,[10.0.0.1]:55553
+//	dns [<host[:port]>]              DNS TXT records, system servers by default
+//	static <address> <name>...       static entry, as in a hosts file
+type resolverConfig struct {
+	static  hostsTable
+	entries []resolverEntry
+}
+
+// defaultResolverConfig returns the sources used if no configuration file
+// exists.
+func defaultResolverConfig() *resolverConfig {
+	c := &resolverConfig{
+		entries: []resolverEntry{
+			{kindHosts, resolveEtcHosts},
+			{kindHosts, resolveEtcScionHosts},
+		},
+	}
+	if resolveRains != nil {
+		c.entries = append(c.entries, cachedEntry(kindRains, resolveRains))
+	}
+	c.entries = append(c.entries, cachedEntry(kindDNS, &DNSResolver{}))
+	return c
+}
+
+// loadDefaultResolverConfig loads the configuration file from the path in
+// EnvResolverConfig or from resolverConfigPath. If the file does not exist or
+// is invalid, the built-in default sources are used.
+func loadDefaultResolverConfig() *resolverConfig {
+	path, ok := os.LookupEnv(EnvResolverConfig)
+	if !ok || path == "" {
+		path = resolverConfigPath
+	}
+	c, err := loadResolverConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: %v, using default resolvers\n", err)
+	}
+	if c == nil {
+		return defaultResolverConfig()
+	}
+	return c
+}
+
+// loadResolverConfig reads the configuration file. Returns nil, without
+// error, if the file does not exist.
+func loadResolverConfig(path string) (*resolverConfig, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error loading %s: %s", path, err)
+	}
+	defer file.Close()
+	c, err := parseResolverConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+	return c, nil
+}
+
+func parseResolverConfig(r io.Reader) (*resolverConfig, error) {
+	c := &resolverConfig{static: make(hostsTable)}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if cstart := strings.IndexRune(line, '#'); cstart >= 0 {
+			line = line[:cstart]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := c.parseDirective(fields[0], fields[1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *resolverConfig) parseDirective(directive string, args []string) error {
+	switch directive {
+	case "hosts":
+		if len(args) != 1 {
+			return errors.New("expected hosts <path>")
+		}
+		c.entries = append(c.entries, resolverEntry{kindHosts, &hostsfileResolver{path: args[0]}})
+	case "rains":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("expected rains <address> [timeout=<duration>]")
+		}
+		if newRainsResolver == nil {
+			return errors.New("RAINS support disabled (built with norains)")
+		}
+		server, err := snet.ParseUDPAddr(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid RAINS server address %q: %s", args[0], err)
+		}
+		timeout := rainsDefaultTimeout
+		if len(args) == 2 {
+			if !strings.HasPrefix(args[1], "timeout=") {
+				return fmt.Errorf("unknown RAINS option %q", args[1])
+			}
+			timeout, err = time.ParseDuration(strings.TrimPrefix(args[1], "timeout="))
+			if err != nil {
+				return fmt.Errorf("invalid RAINS timeout: %s", err)
+			}
+		}
+		c.entries = append(c.entries, cachedEntry(kindRains, newRainsResolver(server, timeout)))
+	case "dns":
+		if len(args) > 1 {
+			return errors.New("expected dns [<host[:port]>]")
+		}
+		var server string
+		if len(args) == 1 {
+			server = args[0]
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+			}
+		}
+		c.entries = append(c.entries, cachedEntry(kindDNS, &DNSResolver{Server: server}))
+	case "static":
+		if len(args) < 2 {
+			return errors.New("expected static <address> <name>...")
+		}
+		addr, err := addrFromString(args[0])
+		if err != nil {
+			return err
+		}
+		for _, name := range args[1:] {
+			c.static[name] = addr
+		}
+	default:
+		return fmt.Errorf("unknown directive %q", directive)
+	}
+	return nil
+}
+
+// list returns the resolvers in order of precedence. If dns is not nil, it
+// replaces the DNS resolvers of the configuration and is placed at the given
+// position.
+func (c *resolverConfig) list(dns Resolver, position DNSPosition) ResolverList {
+	var list ResolverList
+	if len(c.static) > 0 {
+		list = append(list, c.static)
+	}
+	pending := dns != nil && position != DNSDisabled // dns yet to be inserted
+	if pending && position == DNSFirst {
+		list = append(list, dns)
+		pending = false
+	}
+	for _, e := range c.entries {
+		if e.kind == kindDNS && dns != nil {
+			continue
+		}
+		if pending && e.kind == kindRains && position == DNSBeforeRains {
+			list = append(list, dns)
+			pending = false
+		}
+		list = append(list, e.resolver)
+	}
+	if pending {
+		list = append(list, dns)
+	}
+	return list
+}
@@ -15,8 +15,13 @@
 package appnet
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
@@ -37,7 +42,7 @@ func TestCount(t *testing.T) {
 }
 
 func TestHostsfileResolver(t *testing.T) {
-	resolver := &hostsfileResolver{hostsTestFile}
+	resolver := &hostsfileResolver{path: hostsTestFile}
 
 	cases := []testCase{
 		{"host1.1", mustParse("17-ffaa:0:1,[192.168.1.1]")},
@@ -54,8 +59,24 @@ func TestHostsfileResolver(t *testing.T) {
 	testResolver(t, resolver, cases)
 }
 
+func TestHostsfileReverseResolver(t *testing.T) {
+	resolver := ResolverList{&hostsfileResolver{path: hostsTestFile}}
+
+	names, err := resolver.ResolveAddr(context.Background(), *mustParse("17-ffaa:0:1,[192.168.1.1]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, " ") != "host1.1 host1.2 host3" {
+		t.Errorf("expected host1.1 host1.2 host3, got %v", names)
+	}
+	_, err = resolver.ResolveAddr(context.Background(), *mustParse("17-ffaa:0:1,[192.168.1.2]"))
+	if _, ok := err.(*HostNotFoundError); !ok {
+		t.Errorf("expected HostNotFoundError, got %v", err)
+	}
+}
+
 func TestHostsfileResolverNonexisting(t *testing.T) {
-	resolver := &hostsfileResolver{"non_existing_hosts_file"}
+	resolver := &hostsfileResolver{path: "non_existing_hosts_file"}
 	testResolver(t, resolver, []testCase{{"something", nil}})
 }
 
@@ -94,6 +115,192 @@ func (r dummyResolver) Resolve(name string) (*snet.SCIONAddress, error) {
 	}
 }
 
+// countingResolver counts the lookups passed to the wrapped resolver.
+type countingResolver struct {
+	Resolver
+	count int
+}
+
+func (r *countingResolver) Resolve(name string) (*snet.SCIONAddress, error) {
+	r.count++
+	return r.Resolver.Resolve(name)
+}
+
+func TestCachingResolver(t *testing.T) {
+	backend := &countingResolver{Resolver: dummyResolver{map[string]*snet.SCIONAddress{
+		"foo": mustParse("1-ff00:0:f00,[192.0.2.1]"),
+	}}}
+	resolver := NewCachingResolver(backend)
+
+	cases := []testCase{
+		{"foo", mustParse("1-ff00:0:f00,[192.0.2.1]")},
+		{"boo", nil},
+	}
+	testResolver(t, resolver, cases)
+	testResolver(t, resolver, cases)
+	if backend.count != 2 {
+		t.Errorf("expected 2 lookups, answers from cache otherwise, got %d", backend.count)
+	}
+
+	resolver.Flush()
+	resolver.NegativeTTL = 0
+	testResolver(t, resolver, cases)
+	testResolver(t, resolver, cases)
+	if backend.count != 5 {
+		t.Errorf("expected 5 lookups, host not found not cached, got %d", backend.count)
+	}
+}
+
+// blockingResolver blocks until the context is done.
+type blockingResolver struct{}
+
+func (r blockingResolver) Resolve(name string) (*snet.SCIONAddress, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+func (r blockingResolver) ResolveContext(ctx context.Context, name string) (*snet.SCIONAddress, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestResolveContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resolver := ResolverList{blockingResolver{}}
+	if _, err := ResolveUDPAddrAtContext(ctx, "foo:1234", resolver); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// resolvers without context support are not invoked after cancellation
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	backend := &countingResolver{Resolver: dummyResolver{map[string]*snet.SCIONAddress{
+		"foo": mustParse("1-ff00:0:f00,[192.0.2.1]"),
+	}}}
+	if _, err := ResolveUDPAddrAtContext(ctx, "foo:1234", backend); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := (ResolverList{backend}).ResolveContext(ctx, "foo"); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if backend.count != 0 {
+		t.Errorf("expected no lookups after cancellation, got %d", backend.count)
+	}
+
+	addr, err := ResolveUDPAddrAt("foo:1234", backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Host.Port != 1234 || backend.count != 1 {
+		t.Errorf("unexpected result %v after %d lookups", addr, backend.count)
+	}
+}
+
+func TestHostsfileResolverReload(t *testing.T) {
+	file, err := ioutil.TempFile("", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	resolver := &hostsfileResolver{path: file.Name()}
+
+	if err := ioutil.WriteFile(file.Name(), []byte("1-ff00:0:f00,[192.0.2.1] foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testResolver(t, resolver, []testCase{
+		{"foo", mustParse("1-ff00:0:f00,[192.0.2.1]")},
+		{"bar", nil},
+	})
+
+	if err := ioutil.WriteFile(file.Name(), []byte("1-ff00:0:ba3,[192.0.2.1] bar # changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resolver.checked = time.Now().Add(-hostsfileCheckInterval) // skip waiting for the next check
+	testResolver(t, resolver, []testCase{
+		{"foo", nil},
+		{"bar", mustParse("1-ff00:0:ba3,[192.0.2.1]")},
+	})
+}
+
+// TestResolverConfigCaching checks that the answers of remote sources are
+// cached independently of the hosts files, which take effect immediately.
+func TestResolverConfigCaching(t *testing.T) {
+	file, err := ioutil.TempFile("", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	hostsfile := &hostsfileResolver{path: file.Name()}
+	backend := &countingResolver{Resolver: dummyResolver{map[string]*snet.SCIONAddress{
+		"foo": mustParse("1-ff00:0:f00,[192.0.2.1]"),
+	}}}
+	c := &resolverConfig{
+		entries: []resolverEntry{{kindHosts, hostsfile}, cachedEntry(kindRains, backend)},
+	}
+	list := c.list(nil, DNSLast)
+
+	testResolver(t, list, []testCase{{"foo", mustParse("1-ff00:0:f00,[192.0.2.1]")}})
+	// the miss in the hosts file does not limit the validity of the answer
+	time.Sleep(hostsfileCheckInterval + 100*time.Millisecond)
+	testResolver(t, list, []testCase{{"foo", mustParse("1-ff00:0:f00,[192.0.2.1]")}})
+	if backend.count != 1 {
+		t.Errorf("expected 1 lookup, answers from cache otherwise, got %d", backend.count)
+	}
+
+	if err := ioutil.WriteFile(file.Name(), []byte("1-ff00:0:f01,[192.0.2.1] foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hostsfile.checked = time.Now().Add(-hostsfileCheckInterval) // skip waiting for the next check
+	testResolver(t, list, []testCase{{"foo", mustParse("1-ff00:0:f01,[192.0.2.1]")}})
+}
+
+func TestParseResolverConfig(t *testing.T) {
+	config := `
+# comment
+static 17-ffaa:0:1,[192.168.1.1] host1 host1.example.org
+hosts hosts_test_file  # trailing comment
+hosts /etc/hosts
+dns 10.0.0.53
+`
+	c, err := parseResolverConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := c.list(nil, DNSLast)
+	if len(list) != 4 {
+		t.Fatalf("expected static entries and 3 resolvers, got %v", list)
+	}
+	if dns, ok := list[3].(*CachingResolver); !ok ||
+		dns.Resolver.(*DNSResolver).Server != "10.0.0.53:53" {
+		t.Errorf("expected cached DNS resolver with default port last, got %v", list[3])
+	}
+	testResolver(t, list[:3], []testCase{
+		{"host1.example.org", mustParse("17-ffaa:0:1,[192.168.1.1]")},
+		{"host2", mustParse("18-ffaa:1:2,[10.0.8.10]")},
+	})
+
+	dns := &DNSResolver{Server: "192.0.2.53:53"}
+	if list := c.list(dns, DNSFirst); list[1] != dns || len(list) != 4 {
+		t.Errorf("expected DNS override after static entries, got %v", list)
+	}
+	if list := c.list(dns, DNSDisabled); len(list) != 3 {
+		t.Errorf("expected DNS removed, got %v", list)
+	}
+
+	for _, invalid := range []string{
+		"hosts",
+		"dns a b",
+		"static 17-ffaa:0:1,[192.168.1.1]",
+		"static foo bar",
+		"rains 19-ffaa:0:1,[10.0.0.1]:55553 retries=3",
+		"nameserver 10.0.0.53",
+	} {
+		if _, err := parseResolverConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
 type testCase struct {
 	name     string
 	expected *snet.SCIONAddress
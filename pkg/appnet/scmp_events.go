@@ -0,0 +1,200 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"net"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/slayers"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+// scmpEventQueueSize is the number of SCMP events buffered per conn. Further
+// events are dropped until the application catches up.
+const scmpEventQueueSize = 64
+
+// SCMPEventType is the kind of an SCMPEvent.
+type SCMPEventType int
+
+const (
+	// SCMPInterfaceDown reports an interface on the path as down (SCMP
+	// external interface down or internal connectivity down).
+	SCMPInterfaceDown SCMPEventType = iota
+	// SCMPPacketTooBig reports that a packet exceeded the MTU of a link on
+	// the path.
+	SCMPPacketTooBig
+	// SCMPDestinationUnreachable reports that the destination could not be
+	// reached, e.g. because no application listens on the port.
+	SCMPDestinationUnreachable
+)
+
+func (t SCMPEventType) String() string {
+	switch t {
+	case SCMPInterfaceDown:
+		return "interface down"
+	case SCMPPacketTooBig:
+		return "packet too big"
+	case SCMPDestinationUnreachable:
+		return "destination unreachable"
+	}
+	return "unknown"
+}
+
+// SCMPEvent is an SCMP error received for a packet sent over an SCMPConn.
+type SCMPEvent struct {
+	Type SCMPEventType
+	// Code is the SCMP code of the message.
+	Code slayers.SCMPCode
+	// Source is the address of the router or host that sent the message.
+	Source snet.SCIONAddress
+	// Remote is the destination of the packet that caused the error, if it can
+	// be determined from the quote in the SCMP message, otherwise nil.
+	Remote *snet.UDPAddr
+	// Path is the path of the packet that caused the error. If the quoted
+	// packet cannot be decoded, this is the reverse of the path of the SCMP
+	// message, i.e. the path up to the AS reporting the error.
+	Path spath.Path
+	// IA and Interface identify the interface reported down, for
+	// SCMPInterfaceDown. For internal connectivity down, this is the egress
+	// interface.
+	IA        addr.IA
+	Interface common.IFIDType
+	// MTU is the MTU of the link, for SCMPPacketTooBig.
+	MTU uint16
+}
+
+// SCMPConn is a snet.Conn delivering the SCMP errors received for it as
+// SCMPEvents.
+// The events are only delivered while reading from the conn, as SCMP
+// messages are processed by the read calls.
+type SCMPConn struct {
+	*snet.Conn
+	events chan SCMPEvent
+}
+
+// SCMPEvents returns the channel on which the SCMP errors received for this
+// conn are delivered. Events are dropped if the channel is not drained.
+func (c *SCMPConn) SCMPEvents() <-chan SCMPEvent {
+	return c.events
+}
+
+// ListenSCMP acts like Listen, but returns a conn delivering SCMP errors as
+// events.
+func ListenSCMP(listen *net.UDPAddr) (*SCMPConn, error) {
+	return DefNetwork().ListenSCMPContext(context.Background(), listen)
+}
+
+// DialAddrSCMP acts like DialAddr, but returns a conn delivering SCMP errors
+// as events.
+func DialAddrSCMP(raddr *snet.UDPAddr) (*SCMPConn, error) {
+	return DefNetwork().DialAddrSCMPContext(context.Background(), raddr)
+}
+
+// ListenSCMPContext acts like ListenContext, but returns a conn delivering
+// SCMP errors as events.
+func (n *Network) ListenSCMPContext(ctx context.Context, listen *net.UDPAddr) (*SCMPConn, error) {
+	events := make(chan SCMPEvent, scmpEventQueueSize)
+	network, wildcard := n.networks(&scmpEventHandler{next: n.scmpHandler, events: events})
+	conn, err := n.listen(ctx, listen, network, wildcard)
+	if err != nil {
+		return nil, err
+	}
+	return &SCMPConn{Conn: conn, events: events}, nil
+}
+
+// DialAddrSCMPContext acts like DialAddrContext, but returns a conn
+// delivering SCMP errors as events.
+func (n *Network) DialAddrSCMPContext(ctx context.Context, raddr *snet.UDPAddr) (*SCMPConn, error) {
+	events := make(chan SCMPEvent, scmpEventQueueSize)
+	network, _ := n.networks(&scmpEventHandler{next: n.scmpHandler, events: events})
+	conn, err := n.dialAddr(ctx, raddr, network)
+	if err != nil {
+		return nil, err
+	}
+	return &SCMPConn{Conn: conn, events: events}, nil
+}
+
+// scmpEventHandler is the snet.SCMPHandler of a SCMPConn. After processing
+// by the network's handler, errors are delivered as events.
+type scmpEventHandler struct {
+	next   snet.SCMPHandler
+	events chan SCMPEvent
+}
+
+func (h *scmpEventHandler) Handle(pkt *snet.Packet) error {
+	err := h.next.Handle(pkt)
+	if ev, ok := newSCMPEvent(pkt); ok {
+		select {
+		case h.events <- ev:
+		default:
+		}
+	}
+	return err
+}
+
+// newSCMPEvent converts the SCMP packet to an event, returning false for
+// informational messages and unsupported errors.
+func newSCMPEvent(pkt *snet.Packet) (SCMPEvent, bool) {
+	scmp, ok := pkt.Payload.(snet.SCMPPayload)
+	if !ok {
+		return SCMPEvent{}, false
+	}
+	ev := SCMPEvent{
+		Code:   scmp.Code(),
+		Source: pkt.Source,
+	}
+	var quote []byte
+	switch msg := pkt.Payload.(type) {
+	case snet.SCMPExternalInterfaceDown:
+		ev.Type = SCMPInterfaceDown
+		ev.IA, ev.Interface = msg.IA, common.IFIDType(msg.Interface)
+		quote = msg.Payload
+	case snet.SCMPInternalConnectivityDown:
+		ev.Type = SCMPInterfaceDown
+		ev.IA, ev.Interface = msg.IA, common.IFIDType(msg.Egress)
+		quote = msg.Payload
+	case snet.SCMPPacketTooBig:
+		ev.Type = SCMPPacketTooBig
+		ev.MTU = msg.MTU
+		quote = msg.Payload
+	case snet.SCMPDestinationUnreachable:
+		ev.Type = SCMPDestinationUnreachable
+		quote = msg.Payload
+	default:
+		return SCMPEvent{}, false
+	}
+
+	offending := snet.Packet{Bytes: append(snet.Bytes(nil), quote...)}
+	if err := offending.Decode(); err == nil {
+		ev.Path = offending.Path
+		if udp, ok := offending.Payload.(snet.UDPPayload); ok && offending.Destination.Host != nil {
+			ev.Remote = &snet.UDPAddr{
+				IA:   offending.Destination.IA,
+				Host: &net.UDPAddr{IP: offending.Destination.Host.IP(), Port: int(udp.DstPort)},
+				Path: offending.Path,
+			}
+		}
+	} else {
+		ev.Path = pkt.Path.Copy()
+		if err := ev.Path.Reverse(); err != nil {
+			ev.Path = spath.Path{}
+		}
+	}
+	return ev, true
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func TestNewSCMPEvent(t *testing.T) {
+	local := snet.SCIONAddress{IA: addr.IA{I: 1, A: 0xff0000000110}, Host: addr.HostFromIP(net.ParseIP("10.0.0.1"))}
+	remote := snet.SCIONAddress{IA: local.IA, Host: addr.HostFromIP(net.ParseIP("10.0.0.2"))}
+	offending := &snet.Packet{
+		Bytes: make(snet.Bytes, common.MaxMTU),
+		PacketInfo: snet.PacketInfo{
+			Source:      local,
+			Destination: remote,
+			Payload:     snet.UDPPayload{SrcPort: 40000, DstPort: 443, Payload: []byte("hello")},
+		},
+	}
+	if err := offending.Serialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := &snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Source:      remote,
+			Destination: local,
+			Payload:     snet.SCMPPacketTooBig{MTU: 1280, Payload: offending.Bytes},
+		},
+	}
+	ev, ok := newSCMPEvent(pkt)
+	if !ok {
+		t.Fatal("expected event for packet too big")
+	}
+	if ev.Type != SCMPPacketTooBig || ev.MTU != 1280 {
+		t.Errorf("expected packet too big with MTU 1280, got %v with MTU %d", ev.Type, ev.MTU)
+	}
+	if ev.Remote == nil || ev.Remote.IA != remote.IA || !ev.Remote.Host.IP.Equal(remote.Host.IP()) ||
+		ev.Remote.Host.Port != 443 {
+		t.Errorf("expected remote %s:443, got %v", remote, ev.Remote)
+	}
+
+	echo := &snet.Packet{PacketInfo: snet.PacketInfo{Payload: snet.SCMPEchoReply{}}}
+	if _, ok := newSCMPEvent(echo); ok {
+		t.Error("expected no event for echo reply")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/snet/addrutil"
+)
+
+// localAddrIdleTimeout is the time after which the local address on which a
+// remote was last seen is forgotten.
+const localAddrIdleTimeout = 5 * time.Minute
+
+// wildcardDispatcherService is a snet.PacketDispatcherService that registers
+// at the dispatcher on all local IP addresses, to emulate binding to a
+// wildcard address.
+// The registration address passed to Register determines the port and the
+// primary address, which is used for traffic to remotes that have not sent
+// anything yet.
+type wildcardDispatcherService struct {
+	snet.PacketDispatcherService
+	// localIPs returns the local IP addresses to register on.
+	localIPs func() ([]net.IP, error)
+}
+
+func (s *wildcardDispatcherService) Register(ctx context.Context, ia addr.IA,
+	registration *net.UDPAddr, svc addr.HostSVC) (snet.PacketConn, uint16, error) {
+
+	ips, err := s.localIPs()
+	if err != nil {
+		return nil, 0, err
+	}
+	// Register on the primary address first, to determine the port if
+	// none was specified.
+	primary, port, err := s.PacketDispatcherService.Register(ctx, ia, registration, svc)
+	if err != nil {
+		return nil, 0, err
+	}
+	conns := []localPacketConn{{PacketConn: primary, ip: registration.IP}}
+	for _, ip := range ips {
+		if ip.Equal(registration.IP) {
+			continue
+		}
+		c, _, err := s.PacketDispatcherService.Register(ctx, ia, &net.UDPAddr{IP: ip, Port: int(port)}, svc)
+		if err != nil {
+			for _, lc := range conns {
+				lc.Close()
+			}
+			return nil, 0, err
+		}
+		conns = append(conns, localPacketConn{PacketConn: c, ip: ip})
+	}
+	return newMultiPacketConn(conns), port, nil
+}
+
+// localPacketConn is a snet.PacketConn registered on a local IP address.
+type localPacketConn struct {
+	snet.PacketConn
+	ip net.IP
+}
+
+// receivedPacket is a packet read by one of the conns of a multiPacketConn.
+type receivedPacket struct {
+	pkt  snet.Packet
+	ov   net.UDPAddr
+	conn int
+	err  error
+}
+
+// multiPacketConn multiplexes multiple snet.PacketConns registered on
+// different local IP addresses.
+// Packets to a remote are sent from the local address on which the most
+// recent packet from this remote was received. Packets to other remotes are
+// sent from the local address used to reach the next hop, or from the primary
+// (first) address.
+type multiPacketConn struct {
+	conns   []localPacketConn
+	packets chan receivedPacket
+
+	mutex        sync.Mutex
+	remotes      map[string]remoteLocal
+	lastPurge    time.Time
+	readDeadline time.Time
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type remoteLocal struct {
+	conn     int
+	lastSeen time.Time
+}
+
+func newMultiPacketConn(conns []localPacketConn) *multiPacketConn {
+	c := &multiPacketConn{
+		conns:   conns,
+		packets: make(chan receivedPacket),
+		remotes: make(map[string]remoteLocal),
+		closed:  make(chan struct{}),
+	}
+	for i := range conns {
+		go c.read(i)
+	}
+	return c
+}
+
+// read forwards packets read from the i-th conn until it is closed.
+func (c *multiPacketConn) read(i int) {
+	for {
+		p := receivedPacket{
+			pkt:  snet.Packet{Bytes: make(snet.Bytes, common.MaxMTU)},
+			conn: i,
+		}
+		p.err = c.conns[i].ReadFrom(&p.pkt, &p.ov)
+		select {
+		case c.packets <- p:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *multiPacketConn) ReadFrom(pkt *snet.Packet, ov *net.UDPAddr) error {
+	c.mutex.Lock()
+	deadline := c.readDeadline
+	c.mutex.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-c.packets:
+		if p.err != nil {
+			return p.err
+		}
+		*pkt = p.pkt
+		*ov = p.ov
+		if key, ok := remoteKey(pkt.Source, pkt.Payload, true); ok {
+			c.rememberRemote(key, p.conn)
+		}
+		return nil
+	case <-timeout:
+		return &net.OpError{Op: "read", Net: "scion", Err: os.ErrDeadlineExceeded}
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+func (c *multiPacketConn) WriteTo(pkt *snet.Packet, ov *net.UDPAddr) error {
+	i := c.localConnFor(pkt, ov)
+	pkt.Source.Host = addr.HostFromIP(c.conns[i].ip)
+	return c.conns[i].WriteTo(pkt, ov)
+}
+
+// localConnFor returns the index of the conn over which pkt is sent.
+func (c *multiPacketConn) localConnFor(pkt *snet.Packet, ov *net.UDPAddr) int {
+	if key, ok := remoteKey(pkt.Destination, pkt.Payload, false); ok {
+		c.mutex.Lock()
+		r, ok := c.remotes[key]
+		c.mutex.Unlock()
+		if ok {
+			return r.conn
+		}
+	}
+	if ov != nil {
+		if localIP, err := addrutil.ResolveLocal(ov.IP); err == nil {
+			for i, lc := range c.conns {
+				if lc.ip.Equal(localIP) {
+					return i
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func (c *multiPacketConn) rememberRemote(key string, conn int) {
+	now := time.Now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.remotes[key] = remoteLocal{conn: conn, lastSeen: now}
+	if now.Sub(c.lastPurge) > localAddrIdleTimeout {
+		for k, r := range c.remotes {
+			if now.Sub(r.lastSeen) > localAddrIdleTimeout {
+				delete(c.remotes, k)
+			}
+		}
+		c.lastPurge = now
+	}
+}
+
+func (c *multiPacketConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *multiPacketConn) SetWriteDeadline(t time.Time) error {
+	var errs []error
+	for _, lc := range c.conns {
+		if err := lc.SetWriteDeadline(t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return firstError(errs)
+}
+
+func (c *multiPacketConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *multiPacketConn) Close() error {
+	var errs []error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		for _, lc := range c.conns {
+			if err := lc.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	return firstError(errs)
+}
+
+// remoteKey identifies the remote host and port of a packet, from the SCION
+// address a and the source (or destination) port of the UDP payload.
+func remoteKey(a snet.SCIONAddress, payload snet.Payload, src bool) (string, bool) {
+	udp, ok := payload.(snet.UDPPayload)
+	if !ok || a.Host == nil {
+		return "", false
+	}
+	port := udp.DstPort
+	if src {
+		port = udp.SrcPort
+	}
+	return a.IA.String() + "," + a.Host.String() + ":" + strconv.Itoa(int(port)), true
+}
+
+func firstError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// localIPs returns the IP addresses of this host that can be used to
+// communicate in the local AS, with the default local IP first.
+// These are the unicast addresses of the same IP family as the default local
+// IP; loopback addresses are only included if the default local IP is a
+// loopback address.
+func (n *Network) localIPs() ([]net.IP, error) {
+	defaultIP, err := n.DefaultLocalIP()
+	if err != nil {
+		return nil, err
+	}
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{defaultIP}
+	isV4 := defaultIP.To4() != nil
+	for _, a := range ifAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if (ip.To4() != nil) != isV4 || ip.Equal(defaultIP) ||
+			ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() ||
+			ip.IsLoopback() != defaultIP.IsLoopback() {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
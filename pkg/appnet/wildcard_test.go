@@ -0,0 +1,110 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// chanPacketConn is a snet.PacketConn reading packets from a channel and
+// recording the packets written.
+type chanPacketConn struct {
+	in      chan snet.Packet
+	written []snet.Packet
+	closed  chan struct{}
+}
+
+func newChanPacketConn() *chanPacketConn {
+	return &chanPacketConn{in: make(chan snet.Packet), closed: make(chan struct{})}
+}
+
+func (c *chanPacketConn) ReadFrom(pkt *snet.Packet, ov *net.UDPAddr) error {
+	select {
+	case p := <-c.in:
+		*pkt = p
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+func (c *chanPacketConn) WriteTo(pkt *snet.Packet, ov *net.UDPAddr) error {
+	c.written = append(c.written, *pkt)
+	return nil
+}
+
+func (c *chanPacketConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *chanPacketConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *chanPacketConn) SetDeadline(t time.Time) error      { return nil }
+func (c *chanPacketConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestMultiPacketConnReplyAddress(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000110}
+	ip0 := net.ParseIP("10.0.0.1")
+	ip1 := net.ParseIP("10.0.0.2")
+	conn0 := newChanPacketConn()
+	conn1 := newChanPacketConn()
+	c := newMultiPacketConn([]localPacketConn{
+		{PacketConn: conn0, ip: ip0},
+		{PacketConn: conn1, ip: ip1},
+	})
+	defer c.Close()
+
+	remote := snet.SCIONAddress{IA: ia, Host: addr.HostFromIP(net.ParseIP("10.0.0.100"))}
+	other := snet.SCIONAddress{IA: ia, Host: addr.HostFromIP(net.ParseIP("10.0.0.200"))}
+	conn1.in <- snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Source:      remote,
+			Destination: snet.SCIONAddress{IA: ia, Host: addr.HostFromIP(ip1)},
+			Payload:     snet.UDPPayload{SrcPort: 1234, DstPort: 80},
+		},
+	}
+	var pkt snet.Packet
+	var ov net.UDPAddr
+	if err := c.ReadFrom(&pkt, &ov); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := func(dst snet.SCIONAddress) *snet.Packet {
+		return &snet.Packet{
+			PacketInfo: snet.PacketInfo{
+				Source:      snet.SCIONAddress{IA: ia, Host: addr.HostFromIP(ip0)},
+				Destination: dst,
+				Payload:     snet.UDPPayload{SrcPort: 80, DstPort: 1234},
+			},
+		}
+	}
+	if err := c.WriteTo(reply(remote), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteTo(reply(other), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conn1.written) != 1 || !conn1.written[0].Source.Host.Equal(addr.HostFromIP(ip1)) {
+		t.Errorf("expected reply to known remote from %s, got %v", ip1, conn1.written)
+	}
+	if len(conn0.written) != 1 || !conn0.written[0].Source.Host.Equal(addr.HostFromIP(ip0)) {
+		t.Errorf("expected packet to unknown remote from %s, got %v", ip0, conn0.written)
+	}
+}
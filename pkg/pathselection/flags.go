@@ -0,0 +1,130 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathselection
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/scionproto/scion/go/lib/pathpol"
+)
+
+// Flag names and environment variables used to configure the path selection.
+// The environment variables determine the default values for the flags.
+const (
+	FlagSelect = "path-select"
+	FlagPolicy = "path-policy"
+
+	EnvSelect = "SCION_PATH_SELECT"
+	EnvPolicy = "SCION_PATH_POLICY"
+)
+
+// Config is the user-specified path selection configuration.
+type Config struct {
+	// Select is the name of a registered selection strategy.
+	Select string
+	// Policy optionally refers to a JSON path policy file, in the form "file"
+	// for a file containing a single policy, or "file:name" for a named policy
+	// from a file containing a policy map.
+	Policy string
+}
+
+// DefaultConfig returns the configuration from the environment variables
+// SCION_PATH_SELECT and SCION_PATH_POLICY, falling back to the DefaultSelector
+// without policy.
+func DefaultConfig() Config {
+	c := Config{Select: DefaultSelector}
+	if s, ok := os.LookupEnv(EnvSelect); ok && s != "" {
+		c.Select = s
+	}
+	if p, ok := os.LookupEnv(EnvPolicy); ok {
+		c.Policy = p
+	}
+	return c
+}
+
+// SelectUsage returns the usage string for the path-select flag.
+func SelectUsage() string {
+	return fmt.Sprintf("Path selection strategy, one of: %s (env %s)",
+		strings.Join(Names(), ", "), EnvSelect)
+}
+
+// PolicyUsage returns the usage string for the path-policy flag.
+func PolicyUsage() string {
+	return fmt.Sprintf("Path policy JSON file, optionally with policy name (file[:name]) (env %s)",
+		EnvPolicy)
+}
+
+// RegisterFlags defines the path-select and path-policy flags on fs, storing
+// the values in c. The current values of c are used as defaults.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Select, FlagSelect, c.Select, SelectUsage())
+	fs.StringVar(&c.Policy, FlagPolicy, c.Policy, PolicyUsage())
+}
+
+// NewSelector creates a new Selector for the configured strategy, restricted
+// to the paths allowed by the configured policy.
+func (c Config) NewSelector() (Selector, error) {
+	name := c.Select
+	if name == "" {
+		name = DefaultSelector
+	}
+	selector, err := New(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.Policy == "" {
+		return selector, nil
+	}
+	policy, err := LoadPolicy(c.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return Filtered(policy, selector), nil
+}
+
+// LoadPolicy loads a path policy. spec is of the form "file" for a file
+// containing a single policy, or "file:name" for a named policy from a file
+// containing a policy map (pathpol.PolicyMap).
+func LoadPolicy(spec string) (*pathpol.Policy, error) {
+	file, name := spec, ""
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		file, name = spec[:i], spec[i+1:]
+	}
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+	if name == "" {
+		policy := &pathpol.Policy{}
+		if err := json.Unmarshal(bs, policy); err != nil {
+			return nil, fmt.Errorf("cannot parse policy file %s: %w", file, err)
+		}
+		return policy, nil
+	}
+	var policyMap pathpol.PolicyMap
+	if err := json.Unmarshal(bs, &policyMap); err != nil {
+		return nil, fmt.Errorf("cannot parse policy file %s: %w", file, err)
+	}
+	extPolicy, ok := policyMap[name]
+	if !ok || extPolicy == nil {
+		return nil, fmt.Errorf("no policy with name %s in %s", name, file)
+	}
+	return extPolicy.Policy, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathselection
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/bclicn/color"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// interactiveSelector prompts the user to choose a path. The choice is
+// remembered; the user is only prompted again if the chosen path is no longer
+// available.
+type interactiveSelector struct {
+	mutex  sync.Mutex
+	chosen snet.PathFingerprint
+}
+
+// Interactive returns a Selector that prompts the user on stdin/stdout to
+// choose a path.
+func Interactive() Selector {
+	return &interactiveSelector{}
+}
+
+func (s *interactiveSelector) Select(paths []snet.Path) (snet.Path, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.chosen != "" {
+		for _, p := range paths {
+			if snet.Fingerprint(p) == s.chosen {
+				return p, nil
+			}
+		}
+	}
+	path, err := Prompt(paths)
+	if err != nil {
+		return nil, err
+	}
+	s.chosen = snet.Fingerprint(path)
+	return path, nil
+}
+
+// Prompt presents the user a selection of paths to choose from.
+func Prompt(paths []snet.Path) (snet.Path, error) {
+	fmt.Printf("Available paths to %v\n", paths[0].Destination())
+	for i, path := range paths {
+		fmt.Printf("[%2d] %s\n", i, fmt.Sprintf("%s", path))
+	}
+
+	var selectedPath snet.Path
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("Choose path: ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("no path chosen: %w", ErrNoPath)
+		}
+		pathIndexStr := scanner.Text()
+		pathIndex, err := strconv.Atoi(pathIndexStr)
+		if err == nil && 0 <= pathIndex && pathIndex < len(paths) {
+			selectedPath = paths[pathIndex]
+			break
+		}
+		fmt.Printf("ERROR: Invalid path index %v, valid indices range: [0, %v]\n", pathIndexStr, len(paths)-1)
+	}
+	re := regexp.MustCompile(`\d{1,4}-([0-9a-f]{1,4}:){2}[0-9a-f]{1,4}`)
+	fmt.Printf("Using path:\n %s\n", re.ReplaceAllStringFunc(fmt.Sprintf("%s", selectedPath), color.Cyan))
+	return selectedPath, nil
+}
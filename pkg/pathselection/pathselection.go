@@ -0,0 +1,319 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package pathselection provides path selection strategies shared by the
+applications, and a common way to configure them from command line flags or
+environment variables.
+
+A Selector chooses one path out of the paths available to a destination.
+Selectors are registered by name; the built-in strategies are:
+
+	first:        the first path, in the order returned by sciond (default)
+	shortest:     the path with the fewest hops
+	mtu:          the path with the largest MTU
+	latency:      the path with the lowest latency, according to path metadata
+	bandwidth:    the path with the highest bottleneck bandwidth, according to path metadata
+	random:       a random path, chosen for every packet
+	round-robin:  cycle through the available paths, for every packet
+	interactive:  prompt the user to choose a path
+
+Any of these can be combined with a path policy (see package pathpol), in
+which case only the paths matching the policy are considered.
+*/
+package pathselection
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/pathpol"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// ErrNoPath is returned by a Selector if none of the paths is acceptable.
+var ErrNoPath = errors.New("no path available")
+
+// Selector chooses a path from the paths available to a destination.
+type Selector interface {
+	// Select returns the path to use, out of the available paths to a single
+	// destination. paths is never empty.
+	// Selectors may be stateful (e.g. round-robin); a Selector instance should
+	// only be used for one destination.
+	Select(paths []snet.Path) (snet.Path, error)
+}
+
+// SelectorFunc is an adapter to allow the use of ordinary functions as
+// stateless Selectors.
+type SelectorFunc func(paths []snet.Path) (snet.Path, error)
+
+// Select calls f(paths).
+func (f SelectorFunc) Select(paths []snet.Path) (snet.Path, error) {
+	return f(paths)
+}
+
+// DefaultSelector is the name of the strategy used if nothing else is
+// configured.
+const DefaultSelector = "first"
+
+var registry = struct {
+	sync.RWMutex
+	selectors map[string]func() Selector
+}{
+	selectors: map[string]func() Selector{
+		"first":       First,
+		"shortest":    Shortest,
+		"mtu":         LargestMTU,
+		"latency":     LowestLatency,
+		"bandwidth":   HighestBandwidth,
+		"random":      Random,
+		"round-robin": RoundRobin,
+		"interactive": Interactive,
+	},
+}
+
+// Register makes a selection strategy available by name, e.g. for the
+// path-select flag. newSelector is called to create a fresh Selector
+// for each destination.
+// Registering an already registered name replaces the previous strategy.
+func Register(name string, newSelector func() Selector) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.selectors[name] = newSelector
+}
+
+// New returns a new instance of the selection strategy registered as name.
+func New(name string) (Selector, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	newSelector, ok := registry.selectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown path selection strategy %q", name)
+	}
+	return newSelector(), nil
+}
+
+// Names returns the sorted names of all registered selection strategies.
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.selectors))
+	for name := range registry.selectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// First returns a Selector choosing the first path.
+func First() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return paths[0], nil
+	})
+}
+
+// Shortest returns a Selector choosing the path with the fewest hops.
+// Paths without metadata are only chosen if no path has metadata.
+func Shortest() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return minBy(paths, func(a, b snet.Path) bool {
+			ma, mb := a.Metadata(), b.Metadata()
+			if ma == nil || mb == nil {
+				return ma != nil && mb == nil
+			}
+			return len(ma.Interfaces) < len(mb.Interfaces)
+		}), nil
+	})
+}
+
+// LargestMTU returns a Selector choosing the path with the largest MTU.
+// Paths without metadata are only chosen if no path has metadata.
+func LargestMTU() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return minBy(paths, func(a, b snet.Path) bool {
+			ma, mb := a.Metadata(), b.Metadata()
+			if ma == nil || mb == nil {
+				return ma != nil && mb == nil
+			}
+			return ma.MTU > mb.MTU
+		}), nil
+	})
+}
+
+// LowestLatency returns a Selector choosing the path with the lowest total
+// latency according to the static path metadata. Paths for which the latency
+// is not fully known are only chosen if no path has complete latency
+// information.
+func LowestLatency() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return minBy(paths, func(a, b snet.Path) bool {
+			la, knownA := Latency(a)
+			lb, knownB := Latency(b)
+			if knownA != knownB {
+				return knownA
+			}
+			return la < lb
+		}), nil
+	})
+}
+
+// HighestBandwidth returns a Selector choosing the path with the highest
+// bottleneck bandwidth according to the static path metadata.
+func HighestBandwidth() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return minBy(paths, func(a, b snet.Path) bool {
+			return Bandwidth(a) > Bandwidth(b)
+		}), nil
+	})
+}
+
+// Random returns a Selector choosing a random path on every call.
+func Random() Selector {
+	return SelectorFunc(func(paths []snet.Path) (snet.Path, error) {
+		return paths[rand.Intn(len(paths))], nil
+	})
+}
+
+// roundRobinSelector iterates through the available paths in a circular
+// fashion. For N paths, the i-th call to Select returns the (i % N)-th path.
+type roundRobinSelector struct {
+	mutex sync.Mutex
+	next  int
+}
+
+// RoundRobin returns a Selector cycling through the paths on every call.
+func RoundRobin() Selector {
+	return &roundRobinSelector{}
+}
+
+func (s *roundRobinSelector) Select(paths []snet.Path) (snet.Path, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	path := paths[s.next%len(paths)]
+	s.next = (s.next + 1) % len(paths)
+	return path, nil
+}
+
+// filteredSelector only passes paths matching a policy to the wrapped selector.
+type filteredSelector struct {
+	policy   *pathpol.Policy
+	selector Selector
+}
+
+// Filtered returns a Selector that only considers paths allowed by policy and
+// chooses among these with selector.
+func Filtered(policy *pathpol.Policy, selector Selector) Selector {
+	if policy == nil {
+		return selector
+	}
+	return &filteredSelector{policy: policy, selector: selector}
+}
+
+func (s *filteredSelector) Select(paths []snet.Path) (snet.Path, error) {
+	filtered := s.policy.Filter(paths)
+	if len(filtered) == 0 {
+		return nil, ErrNoPath
+	}
+	return s.selector.Select(filtered)
+}
+
+// Latency returns the total latency of the path, according to the static path
+// metadata, and whether the latency is known for all hops.
+func Latency(path snet.Path) (time.Duration, bool) {
+	meta := path.Metadata()
+	if meta == nil {
+		return 0, false
+	}
+	known := len(meta.Latency) > 0 || len(meta.Interfaces) == 0
+	var total time.Duration
+	for _, l := range meta.Latency {
+		if l < 0 {
+			known = false
+			continue
+		}
+		total += l
+	}
+	return total, known
+}
+
+// Bandwidth returns the bottleneck bandwidth of the path in Kbit/s, according
+// to the static path metadata. Links with unknown bandwidth are ignored;
+// returns 0 if no bandwidth information is available.
+func Bandwidth(path snet.Path) uint64 {
+	meta := path.Metadata()
+	if meta == nil {
+		return 0
+	}
+	var bottleneck uint64
+	for _, bw := range meta.Bandwidth {
+		if bw != 0 && (bottleneck == 0 || bw < bottleneck) {
+			bottleneck = bw
+		}
+	}
+	return bottleneck
+}
+
+// minBy returns the first path p for which no other path q satisfies less(q, p).
+func minBy(paths []snet.Path, less func(a, b snet.Path) bool) snet.Path {
+	best := paths[0]
+	for _, p := range paths[1:] {
+		if less(p, best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// Disjoint returns up to n paths, chosen greedily to share as few interfaces
+// as possible. The first path with metadata is always included; paths without
+// metadata are only chosen after all paths with metadata.
+func Disjoint(paths []snet.Path, n int) []snet.Path {
+	if n >= len(paths) {
+		return paths
+	}
+	used := make(map[snet.PathInterface]int)
+	chosen := make([]snet.Path, 0, n)
+	taken := make([]bool, len(paths))
+	for len(chosen) < n {
+		best, bestShared, bestKnown := -1, 0, false
+		for i, p := range paths {
+			if taken[i] {
+				continue
+			}
+			meta := p.Metadata()
+			known := meta != nil
+			shared := 0
+			if known {
+				for _, intf := range meta.Interfaces {
+					shared += used[intf]
+				}
+			}
+			if best < 0 || (known && !bestKnown) || (known == bestKnown && shared < bestShared) {
+				best, bestShared, bestKnown = i, shared, known
+			}
+		}
+		taken[best] = true
+		chosen = append(chosen, paths[best])
+		if meta := paths[best].Metadata(); meta != nil {
+			for _, intf := range meta.Interfaces {
+				used[intf]++
+			}
+		}
+	}
+	return chosen
+}
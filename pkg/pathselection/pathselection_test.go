@@ -0,0 +1,192 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathselection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+)
+
+// The assumption is that path filtering has already been tested in SCIONProto
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		if _, err := New(name); err != nil {
+			t.Errorf("New(%q) failed: %s", name, err)
+		}
+	}
+	if _, err := New("bogus"); err == nil {
+		t.Errorf("New(\"bogus\") did not fail")
+	}
+}
+
+func TestFirstSelector(t *testing.T) {
+
+	const numPaths = 5
+	const numRepetitions = 3
+	paths := makePaths(numPaths)
+
+	selector := First()
+	for i := 0; i < numRepetitions*numPaths; i++ {
+		expected := paths[0]
+		actual, _ := selector.Select(paths)
+		if actual != expected {
+			t.Fatalf("First path selection: Expected path %v, found path %v", expected, actual)
+		}
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+
+	const numPaths = 5
+	const numRepetitions = 3
+	paths := makePaths(numPaths)
+
+	roundRobinSeq := []snet.Path{}
+	for i := 0; i < numRepetitions; i++ {
+		roundRobinSeq = append(roundRobinSeq, paths...)
+	}
+
+	selector := RoundRobin()
+	for i := 0; i < numRepetitions*numPaths; i++ {
+		expected := roundRobinSeq[i]
+		actual, _ := selector.Select(paths)
+		if actual != expected {
+			t.Fatalf("Round robin path selection: Expected path %v, found path %v", expected, actual)
+		}
+	}
+}
+
+func TestMetadataSelectors(t *testing.T) {
+	ms := time.Millisecond
+	short := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: make([]snet.PathInterface, 2),
+		MTU:        1280,
+		Latency:    []time.Duration{30 * ms},
+		Bandwidth:  []uint64{1000},
+	}}
+	fat := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: make([]snet.PathInterface, 4),
+		MTU:        1472,
+		Latency:    []time.Duration{5 * ms, 5 * ms, 5 * ms},
+		Bandwidth:  []uint64{10000, 0, 50000},
+	}}
+	unknown := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: make([]snet.PathInterface, 4),
+		MTU:        1400,
+		Latency:    []time.Duration{1 * ms, -1, 1 * ms},
+	}}
+	paths := []snet.Path{short, fat, unknown}
+
+	cases := []struct {
+		name     string
+		selector Selector
+		expected snet.Path
+	}{
+		{"shortest", Shortest(), short},
+		{"mtu", LargestMTU(), fat},
+		{"latency", LowestLatency(), fat},
+		{"bandwidth", HighestBandwidth(), fat},
+	}
+	for _, c := range cases {
+		actual, err := c.selector.Select(paths)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+		} else if actual != c.expected {
+			t.Errorf("%s: expected path %v, found path %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func makePaths(num int) []snet.Path {
+	paths := make([]snet.Path, num)
+	for i := 0; i < num; i++ {
+		paths[i] = &snetpath.Path{}
+	}
+	return paths
+}
+
+func TestDisjoint(t *testing.T) {
+	intf := func(id int) snet.PathInterface {
+		return snet.PathInterface{ID: common.IFIDType(id)}
+	}
+	p12 := &snetpath.Path{Meta: snet.PathMetadata{Interfaces: []snet.PathInterface{intf(1), intf(2)}}}
+	p13 := &snetpath.Path{Meta: snet.PathMetadata{Interfaces: []snet.PathInterface{intf(1), intf(3)}}}
+	p45 := &snetpath.Path{Meta: snet.PathMetadata{Interfaces: []snet.PathInterface{intf(4), intf(5)}}}
+	paths := []snet.Path{p12, p13, p45}
+
+	actual := Disjoint(paths, 2)
+	if len(actual) != 2 || actual[0] != p12 || actual[1] != p45 {
+		t.Errorf("Disjoint: expected [%v %v], got %v", p12, p45, actual)
+	}
+	if len(Disjoint(paths, 5)) != len(paths) {
+		t.Errorf("Disjoint: expected all paths if n > len(paths)")
+	}
+}
+
+// noMetadataPath is a path without metadata, as e.g. returned for paths
+// extracted from received packets.
+type noMetadataPath struct {
+	basePath
+}
+
+type basePath interface {
+	snet.Path
+}
+
+func (noMetadataPath) Metadata() *snet.PathMetadata {
+	return nil
+}
+
+func TestNoMetadata(t *testing.T) {
+	none := noMetadataPath{&snetpath.Path{}}
+	meta := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: make([]snet.PathInterface, 6),
+		MTU:        1280,
+	}}
+	paths := []snet.Path{none, meta}
+
+	for name, selector := range map[string]Selector{
+		"shortest":  Shortest(),
+		"mtu":       LargestMTU(),
+		"latency":   LowestLatency(),
+		"bandwidth": HighestBandwidth(),
+	} {
+		if _, err := selector.Select(paths); err != nil {
+			t.Errorf("%s: unexpected error %s", name, err)
+		}
+	}
+	for name, selector := range map[string]Selector{
+		"shortest": Shortest(),
+		"mtu":      LargestMTU(),
+	} {
+		actual, _ := selector.Select(paths)
+		if actual != meta {
+			t.Errorf("%s: expected path with metadata %v, found path %v", name, meta, actual)
+		}
+	}
+
+	actual := Disjoint(paths, 1)
+	if len(actual) != 1 || actual[0] != meta {
+		t.Errorf("Disjoint: expected [%v], got %v", meta, actual)
+	}
+	if len(Disjoint([]snet.Path{none, none, meta}, 2)) != 2 {
+		t.Errorf("Disjoint: expected 2 paths")
+	}
+}
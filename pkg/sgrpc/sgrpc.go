@@ -0,0 +1,97 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sgrpc runs gRPC over SCION.
+// Each gRPC connection is carried over a single QUIC stream, using the stream
+// adapters of appquic. The connection is encrypted and the server
+// authenticated by the TLS handshake of QUIC, configured with the tls.Config
+// passed to Dial and Listen; gRPC transport credentials are not used.
+//
+// Client:
+//
+//	conn, err := sgrpc.Dial(ctx, "17-ffaa:1:a,[127.0.0.1]:1234", tlsConf)
+//	client := pb.NewGreeterClient(conn)
+//
+// Server:
+//
+//	listener, err := sgrpc.ListenPort(1234)
+//	server := grpc.NewServer()
+//	pb.RegisterGreeterServer(server, &greeter{})
+//	server.Serve(listener)
+package sgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/lucas-clemente/quic-go"
+	"google.golang.org/grpc"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+)
+
+// Proto is the TLS application protocol of gRPC over SCION/QUIC.
+const Proto = "grpc-scion"
+
+// ContextDialer returns a dial function for grpc.WithContextDialer, dialing a
+// QUIC stream to the SCION address or host name. If tlsConf is nil, the
+// server certificate is not verified, i.e. the connection is encrypted but
+// unauthenticated.
+func ContextDialer(tlsConf *tls.Config,
+	quicConf *quic.Config) func(ctx context.Context, address string) (net.Conn, error) {
+
+	d := &appquic.Dialer{TLSConfig: tlsConf, QUICConfig: quicConf}
+	if tlsConf == nil {
+		d.TLSConfig = &tls.Config{NextProtos: []string{Proto}}
+		d.Insecure = true
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		return d.DialContext(ctx, appquic.NetworkQUIC, address)
+	}
+}
+
+// Dial creates a gRPC client connection to the target, a SCION address or host
+// name with port, verifying the server with tlsConf and using the default QUIC
+// configuration. If tlsConf is nil, the server is not authenticated.
+// Additional options are applied after the SCION dialer, which they may
+// override.
+func Dial(ctx context.Context, target string, tlsConf *tls.Config,
+	opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(ContextDialer(tlsConf, nil)),
+		grpc.WithInsecure(), // encrypted and authenticated by QUIC
+	}, opts...)
+	return grpc.DialContext(ctx, target, opts...)
+}
+
+// Listen returns a net.Listener for grpc.Server.Serve, accepting QUIC streams
+// on the SCION/UDP address. If tlsConf is nil, the dummy certificate of
+// appquic is used.
+func Listen(listen *net.UDPAddr, tlsConf *tls.Config, quicConf *quic.Config) (net.Listener, error) {
+	if tlsConf == nil {
+		tlsConf = &tls.Config{
+			Certificates: appquic.GetDummyTLSCerts(),
+			NextProtos:   []string{Proto},
+		}
+	}
+	return appquic.ListenStreams(listen, tlsConf, quicConf)
+}
+
+// ListenPort is a shortcut to Listen on a specific port with an unspecified
+// IP address and the default TLS and QUIC configuration.
+func ListenPort(port uint16) (net.Listener, error) {
+	return Listen(&net.UDPAddr{Port: int(port)}, nil, nil)
+}
@@ -15,18 +15,59 @@
 package shttp
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/scionproto/scion/go/lib/snet"
+
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
 	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
 )
 
+// shutdownLinger is the time Shutdown waits after the last request has
+// completed before closing the connections. Closing a connection discards
+// stream data that has not been sent yet, i.e. the end of the last responses.
+const shutdownLinger = 100 * time.Millisecond
+
+// ErrServerClosed is returned by the Serve and ListenAndServe methods after a
+// call to Shutdown.
+var ErrServerClosed = errors.New("shttp: Server closed")
+
 // Server wraps a http3.Server making it work with SCION
+//
+// Of the fields of the embedded http.Server, IdleTimeout closes connections
+// without activity, unless the QuicConfig sets a MaxIdleTimeout. ReadTimeout
+// and WriteTimeout are not used, see ReadBodyTimeout instead.
 type Server struct {
 	*http3.Server
+
+	// ReadBodyTimeout, if set, bounds the time to read the body of each
+	// request. It starts when the handler is called, after the request
+	// headers have been read; http3 does not expose the start of a request.
+	ReadBodyTimeout time.Duration
+
+	// MaxConcurrentStreams limits the number of concurrent requests per
+	// connection. If zero, the quic-go default is used.
+	MaxConcurrentStreams int64
+	// LogRequest, if set, is called for each request before it is handled.
+	// peer is the client's address, including the path on which the request
+	// was received, or nil if it is not known.
+	LogRequest func(r *http.Request, peer *snet.UDPAddr)
+
+	mutex        sync.Mutex
+	conns        map[*serverConn]struct{} // conns of the running calls of Serve
+	inFlight     sync.WaitGroup           // requests being handled
+	shuttingDown bool
+	refuseConns  int32 // set atomically when shutting down, see serverConn
+	setupOnce    sync.Once
 }
 
 // ListenAndServe listens for HTTPS connections on the SCION address addr and calls Serve
@@ -63,31 +104,116 @@ func Serve(conn net.PacketConn, handler http.Handler) error {
 // ListenAndServe listens for QUIC connections on srv.Addr and
 // calls Serve to handle incoming requests
 func (srv *Server) ListenAndServe() error {
+	return srv.ListenAndServeAddrs(srv.Addr)
+}
 
-	laddr, err := net.ResolveUDPAddr("udp", srv.Addr)
-	if err != nil {
+// ListenAndServeAddrs listens for QUIC connections on each of the addresses
+// and serves requests on all of them. It returns when serving on any of them
+// fails, after closing the server.
+func (srv *Server) ListenAndServeAddrs(addrs ...string) error {
+
+	conns := make([]net.PacketConn, 0, len(addrs))
+	for _, addr := range addrs {
+		laddr, err := net.ResolveUDPAddr("udp", addr)
+		if err == nil {
+			var sconn *snet.Conn
+			sconn, err = appnet.Listen(laddr)
+			if err == nil {
+				conns = append(conns, sconn)
+				continue
+			}
+		}
+		for _, c := range conns {
+			c.Close()
+		}
 		return err
 	}
-	sconn, err := appnet.Listen(laddr)
-	if err != nil {
-		return err
+	if len(conns) == 1 {
+		return srv.Serve(conns[0])
+	}
+
+	// the configuration is read by the concurrent calls of Serve
+	srv.setup()
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			errs <- srv.Serve(conn)
+		}(conn)
+	}
+	err := <-errs
+	_ = srv.Close()
+	for range conns[1:] {
+		<-errs
 	}
-	return srv.Serve(sconn)
+	return err
 }
 
 // Serve listens on conn and accepts incoming connections
 // a goroutine is spawned for every request and handled by srv.srv.handler
+// Serve may be called concurrently for multiple conns.
 func (srv *Server) Serve(conn net.PacketConn) error {
 
-	// set dummy TLS config if not set:
-	if srv.TLSConfig == nil {
-		srv.TLSConfig = &tls.Config{}
+	srv.setup()
+
+	srv.mutex.Lock()
+	if srv.shuttingDown {
+		srv.mutex.Unlock()
+		return ErrServerClosed
+	}
+	sc := &serverConn{PacketConn: conn, srv: srv}
+	if sconn, ok := conn.(*snet.Conn); ok {
+		// follow clients changing paths, and remember the paths for LogRequest
+		sc.reply = appquic.NewReplyPathConn(sconn)
+		sc.PacketConn = sc.reply
 	}
-	if len(srv.TLSConfig.Certificates) == 0 {
-		srv.TLSConfig.Certificates = appquic.GetDummyTLSCerts()
+	if srv.conns == nil {
+		srv.conns = make(map[*serverConn]struct{})
+	}
+	srv.conns[sc] = struct{}{}
+	srv.mutex.Unlock()
+
+	err := srv.Server.Serve(sc)
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	delete(srv.conns, sc)
+	if srv.shuttingDown {
+		return ErrServerClosed
 	}
+	return err
+}
 
-	return srv.Server.Serve(conn)
+// setup wraps the handler and sets the TLS and QUIC configuration of the
+// embedded http3.Server, once, before the first call of Serve uses them.
+func (srv *Server) setup() {
+	srv.setupOnce.Do(func() {
+		srv.Handler = &trackingHandler{srv: srv, handler: srv.Handler}
+		// set dummy TLS config if not set:
+		tlsConfig := &tls.Config{}
+		if srv.TLSConfig != nil {
+			tlsConfig = srv.TLSConfig.Clone()
+		}
+		if len(tlsConfig.Certificates) == 0 {
+			tlsConfig.Certificates = appquic.GetDummyTLSCerts()
+		}
+		srv.TLSConfig = tlsConfig
+		srv.QuicConfig = srv.quicConfig()
+	})
+}
+
+// quicConfig returns the QUIC configuration including the server's timeout
+// and stream limits.
+func (srv *Server) quicConfig() *quic.Config {
+	conf := &quic.Config{}
+	if srv.QuicConfig != nil {
+		conf = srv.QuicConfig.Clone()
+	}
+	if conf.MaxIdleTimeout == 0 && srv.IdleTimeout > 0 {
+		conf.MaxIdleTimeout = srv.IdleTimeout
+	}
+	if srv.MaxConcurrentStreams > 0 {
+		conf.MaxIncomingStreams = srv.MaxConcurrentStreams
+	}
+	return conf
 }
 
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients
@@ -95,3 +221,147 @@ func (srv *Server) Serve(conn net.PacketConn) error {
 func (srv *Server) Close() error {
 	return srv.Server.Close()
 }
+
+// Shutdown gracefully shuts down the server: first, new connections are
+// refused, and new requests on existing connections are refused with status
+// 503 Service Unavailable. Once all requests in flight have completed, the
+// server is closed. If ctx is done before, the server is closed immediately
+// and the context's error is returned.
+//
+// The listeners are only closed at the end, as quic-go closes all connections
+// of a listener along with it.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mutex.Lock()
+	srv.shuttingDown = true
+	srv.mutex.Unlock()
+	atomic.StoreInt32(&srv.refuseConns, 1)
+
+	done := make(chan struct{})
+	go func() {
+		srv.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		_ = srv.Close()
+		return ctx.Err()
+	}
+
+	linger := time.NewTimer(shutdownLinger)
+	defer linger.Stop()
+	select {
+	case <-linger.C:
+	case <-ctx.Done():
+	}
+	return srv.Close()
+}
+
+// peer returns the client address of the request, including the path of the
+// most recent packet received from it.
+func (srv *Server) peer(r *http.Request) *snet.UDPAddr {
+	remote, err := snet.ParseUDPAddr(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	for c := range srv.conns {
+		if c.reply == nil {
+			continue
+		}
+		if addr := c.reply.LastAddr(remote); addr != nil {
+			return addr
+		}
+	}
+	return remote
+}
+
+// startRequest registers a request, returning false if the server is
+// shutting down.
+func (srv *Server) startRequest() bool {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if srv.shuttingDown {
+		return false
+	}
+	srv.inFlight.Add(1)
+	return true
+}
+
+// serverConn wraps the conn of a call to Serve. Once the server is shutting
+// down, it drops QUIC Initial packets, with which clients open new
+// connections, while the existing connections continue to be served.
+type serverConn struct {
+	net.PacketConn
+	srv *Server
+	// reply is the PacketConn, if serving on a *snet.Conn, or nil
+	reply *appquic.ReplyPathConn
+}
+
+func (c *serverConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, from, err := c.PacketConn.ReadFrom(b)
+		if err == nil && isInitialPacket(b[:n]) && atomic.LoadInt32(&c.srv.refuseConns) != 0 {
+			continue
+		}
+		return n, from, err
+	}
+}
+
+// isInitialPacket returns whether b starts with a QUIC Initial packet, i.e. a
+// long header packet of type 0.
+func isInitialPacket(b []byte) bool {
+	return len(b) > 0 && b[0]&0xc0 == 0xc0 && b[0]&0x30 == 0
+}
+
+// peerContextKey is the context key for the peer address of a request.
+type peerContextKey struct{}
+
+// PeerFromRequest returns the SCION address of the client that sent the
+// request, served by a Server. This allows handlers to e.g. restrict access
+// based on the client's IA. The address includes the reply path, i.e. the
+// reverse of the path on which the most recent packet from the client was
+// received.
+// Returns nil if the address is not known, e.g. for requests not served over
+// SCION.
+// The returned address must not be modified.
+func PeerFromRequest(r *http.Request) *snet.UDPAddr {
+	peer, _ := r.Context().Value(peerContextKey{}).(*snet.UDPAddr)
+	return peer
+}
+
+// trackingHandler wraps the handler of a Server to keep track of the requests
+// in flight, to apply the ReadBodyTimeout and LogRequest options and to attach the
+// peer address to the request context.
+type trackingHandler struct {
+	srv     *Server
+	handler http.Handler
+}
+
+func (h *trackingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.srv.startRequest() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.srv.inFlight.Done()
+
+	if h.srv.ReadBodyTimeout > 0 && r.Body != nil {
+		// closing the body aborts a pending read
+		body := r.Body
+		timer := time.AfterFunc(h.srv.ReadBodyTimeout, func() { body.Close() })
+		defer timer.Stop()
+	}
+	peer := h.srv.peer(r)
+	if peer != nil {
+		r = r.WithContext(context.WithValue(r.Context(), peerContextKey{}, peer))
+	}
+	if h.srv.LogRequest != nil {
+		h.srv.LogRequest(r, peer)
+	}
+	handler := h.handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	handler.ServeHTTP(w, r)
+}
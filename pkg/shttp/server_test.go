@@ -0,0 +1,257 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appnettest"
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+)
+
+func TestServerQuicConfig(t *testing.T) {
+	srv := &Server{
+		Server: &http3.Server{
+			Server: &http.Server{IdleTimeout: time.Minute},
+		},
+		MaxConcurrentStreams: 10,
+	}
+	conf := srv.quicConfig()
+	if conf.MaxIdleTimeout != time.Minute {
+		t.Errorf("expected MaxIdleTimeout %v, got %v", time.Minute, conf.MaxIdleTimeout)
+	}
+	if conf.MaxIncomingStreams != 10 {
+		t.Errorf("expected MaxIncomingStreams 10, got %d", conf.MaxIncomingStreams)
+	}
+
+	srv.QuicConfig = &quic.Config{MaxIdleTimeout: time.Second}
+	if conf := srv.quicConfig(); conf.MaxIdleTimeout != time.Second {
+		t.Errorf("expected MaxIdleTimeout of QuicConfig %v, got %v", time.Second, conf.MaxIdleTimeout)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &Server{
+		Server: &http3.Server{
+			Server: &http.Server{},
+		},
+	}
+	h := &trackingHandler{srv: srv, handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected Shutdown to time out with request in flight, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d after Shutdown, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	close(release)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error from Shutdown: %v", err)
+	}
+}
+
+func TestPeerFromRequest(t *testing.T) {
+	srv := &Server{
+		Server: &http3.Server{
+			Server: &http.Server{},
+		},
+	}
+	var peer *snet.UDPAddr
+	h := &trackingHandler{srv: srv, handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = PeerFromRequest(r)
+	})}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "1-ff00:0:110,[127.0.0.1]:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	expected, _ := snet.ParseUDPAddr(r.RemoteAddr)
+	if peer == nil || peer.IA != expected.IA || !peer.Host.IP.Equal(expected.Host.IP) ||
+		peer.Host.Port != expected.Host.Port {
+		t.Errorf("expected peer %s, got %v", r.RemoteAddr, peer)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if peer != nil {
+		t.Errorf("expected no peer for non-SCION request, got %v", peer)
+	}
+}
+
+// servingPorts waits until srv serves on n conns and returns their ports.
+func servingPorts(t *testing.T, srv *Server, n int) []int {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.mutex.Lock()
+		var ports []int
+		for c := range srv.conns {
+			ports = append(ports, c.LocalAddr().(*net.UDPAddr).Port)
+		}
+		srv.mutex.Unlock()
+		if len(ports) == n {
+			return ports
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server not serving on %d conns", n)
+	return nil
+}
+
+// TestListenAndServeAddrs serves on two ports of a fake SCION network and
+// checks that ReadBodyTimeout aborts slow uploads and that Shutdown refuses new
+// connections while waiting for the requests in flight.
+func TestListenAndServeAddrs(t *testing.T) {
+	ia := addr.IA{I: 1, A: 0xff0000000111}
+	topo := appnettest.NewTopology()
+	topo.SetDefault(ia)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(ioutil.Discard, r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+	})
+	mux.HandleFunc("/wait", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte("done"))
+		w.(http.Flusher).Flush()
+	})
+	srv := &Server{
+		Server: &http3.Server{
+			Server: &http.Server{
+				Handler: mux,
+			},
+		},
+		ReadBodyTimeout: 200 * time.Millisecond,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServeAddrs(
+			fmt.Sprintf("%s:0", appnettest.HostIP),
+			fmt.Sprintf("%s:0", appnettest.HostIP))
+	}()
+	ports := servingPorts(t, srv, 2)
+
+	client := func(port int) *http.Client {
+		raddr := &snet.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: port}}
+		return &http.Client{
+			Transport: &http3.RoundTripper{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				Dial: func(network, address string, tlsCfg *tls.Config,
+					cfg *quic.Config) (quic.EarlySession, error) {
+					return appquic.DialAddrEarly(raddr, "server", tlsCfg, cfg)
+				},
+			},
+			Timeout: 5 * time.Second,
+		}
+	}
+
+	// the body is never completed
+	body, bodyWriter := io.Pipe()
+	defer bodyWriter.Close()
+	go func() { _, _ = bodyWriter.Write([]byte("incomplete")) }()
+	resp, err := client(ports[0]).Post("https://server/upload", "text/plain", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expected status %d for slow upload, got %d", http.StatusRequestTimeout, resp.StatusCode)
+	}
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := client(ports[1]).Get("https://server/wait")
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			responses <- err.Error()
+			return
+		}
+		responses <- string(buf)
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not started")
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned with request in flight: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	dialCtx, cancelDial := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelDial()
+	raddr := &snet.UDPAddr{IA: ia, Host: &net.UDPAddr{IP: appnettest.HostIP, Port: ports[0]}}
+	if sess, err := appquic.DialAddrContext(dialCtx, raddr, "server",
+		&tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h3-29"}}, nil); err == nil {
+		_ = sess.CloseWithError(0, "")
+		t.Error("expected new connection to be refused during Shutdown")
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned with request in flight: %v", err)
+	default:
+	}
+	close(release)
+	if resp := <-responses; resp != "done" {
+		t.Errorf("expected the request in flight to complete, got %q", resp)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("unexpected error from Shutdown: %v", err)
+	}
+	if err := <-serveErr; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+	if len(srv.conns) != 0 {
+		t.Errorf("expected conns to be removed after Serve returned, got %d", len(srv.conns))
+	}
+}
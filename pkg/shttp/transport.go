@@ -28,6 +28,7 @@ import (
 	"github.com/lucas-clemente/quic-go/http3"
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
 	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 )
 
 // RoundTripper extends the http.RoundTripper interface with a Close
@@ -48,6 +49,35 @@ func NewRoundTripper(tlsClientCfg *tls.Config, quicCfg *quic.Config) RoundTrippe
 	}
 }
 
+// NewRoundTripperWithPathSelection creates a new RoundTripper, analogous to
+// NewRoundTripper, which dials each server over the path chosen according to
+// pathConf.
+func NewRoundTripperWithPathSelection(tlsClientCfg *tls.Config, quicCfg *quic.Config,
+	pathConf pathselection.Config) RoundTripper {
+	dialWithPathSelection := func(network, address string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error) {
+		remote := appnet.UnmangleSCIONAddr(address)
+		raddr, err := appnet.ResolveUDPAddr(remote)
+		if err != nil {
+			return nil, err
+		}
+		selector, err := pathConf.NewSelector()
+		if err != nil {
+			return nil, err
+		}
+		if err := appnet.SelectPath(raddr, selector); err != nil {
+			return nil, err
+		}
+		return appquic.DialAddrEarly(raddr, remote, tlsCfg, cfg)
+	}
+	return &roundTripper{
+		&http3.RoundTripper{
+			Dial:            dialWithPathSelection,
+			QuicConfig:      quicCfg,
+			TLSClientConfig: tlsClientCfg,
+		},
+	}
+}
+
 var _ RoundTripper = (*roundTripper)(nil)
 
 // roundTripper implements the RoundTripper interface. It wraps a
@@ -25,8 +25,11 @@ type ClientConfig struct {
 	IdentityFile           []string `regex:".*"`
 	LocalForward           string   `regex:".*"`
 	RemoteForward          string   `regex:".*"`
+	DynamicForward         string   `regex:"0*([0-5]?\\d{0,4}|6([0-4]\\d{3}|5([0-4]\\d{2}|5([0-2]\\d|3[0-5]))))"`
 	UserKnownHostsFile     string   `regex:".*"`
 	ProxyCommand           string   `regex:".*"`
+	ProxyJump              string   `regex:".*"`
+	SendEnv                []string `regex:".*"`
 }
 
 // Create creates a new ClientConfig with the default values.
@@ -46,8 +49,11 @@ func Create() *ClientConfig {
 			"~/.ssh/id_rsa",
 			"~/.ssh/identity",
 		},
-		LocalForward:  "",
-		RemoteForward: "",
-		ProxyCommand:  "",
+		LocalForward:   "",
+		RemoteForward:  "",
+		DynamicForward: "",
+		ProxyCommand:   "",
+		ProxyJump:      "",
+		SendEnv:        []string{"LANG", "LC_*"},
 	}
 }
@@ -0,0 +1,88 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clientutils contains the prompts and configuration handling shared
+// by the command line clients, scion-ssh and scion-sftp.
+package clientutils
+
+import (
+	"fmt"
+	golog "log"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/netsec-ethz/scion-apps/ssh/client/clientconfig"
+	"github.com/netsec-ethz/scion-apps/ssh/config"
+	"github.com/netsec-ethz/scion-apps/ssh/utils"
+)
+
+// PromptPassword prompts the user for a password to authenticate with.
+func PromptPassword() (secret string, err error) {
+	fmt.Printf("Password: ")
+	password, _ := terminal.ReadPassword(0)
+	fmt.Println()
+	return string(password), nil
+}
+
+// PromptAcceptHostKey prompts the user to accept or reject the given host key.
+func PromptAcceptHostKey(hostname string, remote net.Addr, publicKey string) bool {
+	for {
+		fmt.Printf("Key fingerprint SHA256 is: %s do you recognize it? (y/n) ", publicKey)
+		var answer string
+		fmt.Scanln(&answer)
+		answer = strings.ToLower(answer)
+		if strings.HasPrefix(answer, "y") {
+			fmt.Printf("Alright, adding %s to the list of known hosts\n", publicKey)
+			return true
+		} else if strings.HasPrefix(answer, "n") {
+			return false
+		} else {
+			fmt.Printf("Not a valid answer. Try again")
+		}
+	}
+}
+
+// CreateConfig creates a client configuration from the configuration files,
+// skipping files that do not exist, and the options given on the command line.
+func CreateConfig(configFiles, options []string) *clientconfig.ClientConfig {
+	conf := clientconfig.Create()
+
+	for _, configFile := range configFiles {
+		err := config.UpdateFromFile(conf, utils.ParsePath(configFile))
+		if err != nil && !os.IsNotExist(err) {
+			golog.Panicf("Error updating config from file %s: %v", configFile, err)
+		}
+	}
+
+	for _, option := range options {
+		err := config.UpdateFromString(conf, option)
+		if err != nil {
+			log.Debug("Error updating config from --option flag: %v", err)
+		}
+	}
+	return conf
+}
+
+// SetConfIfNot sets the option name of conf to value, unless value equals not.
+func SetConfIfNot(conf *clientconfig.ClientConfig, name string, value, not interface{}) bool {
+	res, err := config.SetIfNot(conf, name, value, not)
+	if err != nil {
+		golog.Panicf("Error setting option %s to %v: %v", name, value, err)
+	}
+	return res
+}
@@ -15,9 +15,7 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	golog "log"
 	"net"
 	"os"
@@ -26,106 +24,77 @@ import (
 	"strings"
 
 	log "github.com/inconshreveable/log15"
-	"golang.org/x/crypto/ssh/terminal"
+	gossh "golang.org/x/crypto/ssh"
 	"gopkg.in/alecthomas/kingpin.v2"
 
-	"github.com/scionproto/scion/go/lib/pathpol"
-
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	"github.com/netsec-ethz/scion-apps/ssh/client/clientconfig"
+	"github.com/netsec-ethz/scion-apps/ssh/client/clientutils"
 	"github.com/netsec-ethz/scion-apps/ssh/client/ssh"
-	"github.com/netsec-ethz/scion-apps/ssh/config"
 	"github.com/netsec-ethz/scion-apps/ssh/scionutils"
-	"github.com/netsec-ethz/scion-apps/ssh/utils"
 )
 
 var (
 	// Connection
-	serverAddress = kingpin.Arg("host-address", "Server SCION address (without the port)").Required().String()
-	runCommand    = kingpin.Arg("command", "Command to run (empty for pty)").Strings()
-	port          = kingpin.Flag("port", "The server's port").Default("0").Short('p').Uint16()
-	localForward  = kingpin.Flag("local-forward", "Forward remote address connections to listening port. Format: listening_port:remote_address").Short('L').String()
-	options       = kingpin.Flag("option", "Set an option").Short('o').Strings()
-	configFiles   = kingpin.Flag("config", "Configuration files").Short('c').Default("/etc/ssh/ssh_config", "~/.ssh/config").Strings()
-	policyFile    = kingpin.Flag("policy-file", "Path to the JSON policy file").Default("").String()
-	policyName    = kingpin.Flag("policy-name", "Name of policy to be applied.").Default("").String()
-	pathSelection = kingpin.Flag("selection", "Path selection mode").Default("arbitrary").Enum("static", "arbitrary", "random", "round-robin")
+	serverAddress  = kingpin.Arg("host-address", "Server SCION address (without the port)").Required().String()
+	runCommand     = kingpin.Arg("command", "Command to run (empty for pty)").Strings()
+	port           = kingpin.Flag("port", "The server's port").Default("0").Short('p').Uint16()
+	localForward   = kingpin.Flag("local-forward", "Forward remote address connections to listening port. Format: listening_port:remote_address").Short('L').String()
+	remoteForward  = kingpin.Flag("remote-forward", "Forward connections to the server's listening port to local address. Format: listening_port:local_address").Short('R').String()
+	dynamicForward = kingpin.Flag("dynamic-forward", "Start a SOCKS5 proxy on listening port, forwarding connections over the server. Format: listening_port").Short('D').String()
+	proxyJump      = kingpin.Flag("proxy-jump", "Connect through the jump hosts. Format: [user@]host[:port][,...]").Short('J').String()
+	options        = kingpin.Flag("option", "Set an option").Short('o').Strings()
+	configFiles    = kingpin.Flag("config", "Configuration files").Short('c').Default("/etc/ssh/ssh_config", "~/.ssh/config").Strings()
 
 	// TODO: additional file paths
 	knownHostsFile = kingpin.Flag("known-hosts", "File where known hosts are stored").ExistingFile()
 	identityFile   = kingpin.Flag("identity", "Identity (private key) file").Short('i').ExistingFile()
 
 	loginName = kingpin.Flag("login-name", "Username to login with").String()
-)
 
-// PromptPassword prompts the user for a password to authenticate with.
-func PromptPassword() (secret string, err error) {
-	fmt.Printf("Password: ")
-	password, _ := terminal.ReadPassword(0)
-	fmt.Println()
-	return string(password), nil
-}
+	// Path selection, flags are registered in main
+	pathConf = pathselection.DefaultConfig()
 
-// PromptAcceptHostKey prompts the user to accept or reject the given host key.
-func PromptAcceptHostKey(hostname string, remote net.Addr, publicKey string) bool {
-	for {
-		fmt.Printf("Key fingerprint SHA256 is: %s do you recognize it? (y/n) ", publicKey)
-		var answer string
-		fmt.Scanln(&answer)
-		answer = strings.ToLower(answer)
-		if strings.HasPrefix(answer, "y") {
-			fmt.Printf("Alright, adding %s to the list of known hosts\n", publicKey)
-			return true
-		} else if strings.HasPrefix(answer, "n") {
-			return false
-		} else {
-			fmt.Printf("Not a valid answer. Try again")
-		}
-	}
-}
-
-func setConfIfNot(conf *clientconfig.ClientConfig, name string, value, not interface{}) bool {
-	res, err := config.SetIfNot(conf, name, value, not)
-	if err != nil {
-		golog.Panicf("Error setting option %s to %v: %v", name, value, err)
-	}
-	return res
-}
+	// Deprecated aliases for path-policy and path-select
+	policyFile    = kingpin.Flag("policy-file", "Deprecated, use --path-policy=file:name").Hidden().String()
+	policyName    = kingpin.Flag("policy-name", "Deprecated, use --path-policy=file:name").Hidden().String()
+	pathSelection = kingpin.Flag("selection", "Deprecated, use --path-select").Hidden().Enum("static", "arbitrary", "random", "round-robin")
+)
 
 func createConfig() *clientconfig.ClientConfig {
-	conf := clientconfig.Create()
-
-	for _, configFile := range *configFiles {
-		updateConfigFromFile(conf, configFile)
-	}
-
-	for _, option := range *options {
-		err := config.UpdateFromString(conf, option)
-		if err != nil {
-			log.Debug("Error updating config from --option flag: %v", err)
-		}
-	}
-
-	setConfIfNot(conf, "Port", *port, 0)
-	setConfIfNot(conf, "HostAddress", *serverAddress, "")
-	setConfIfNot(conf, "IdentityFile", *identityFile, "")
-	setConfIfNot(conf, "LocalForward", *localForward, "")
-	setConfIfNot(conf, "User", *loginName, "")
-	setConfIfNot(conf, "KnownHostsFile", *knownHostsFile, "")
+	conf := clientutils.CreateConfig(*configFiles, *options)
+
+	clientutils.SetConfIfNot(conf, "Port", *port, 0)
+	clientutils.SetConfIfNot(conf, "HostAddress", *serverAddress, "")
+	clientutils.SetConfIfNot(conf, "IdentityFile", *identityFile, "")
+	clientutils.SetConfIfNot(conf, "LocalForward", *localForward, "")
+	clientutils.SetConfIfNot(conf, "RemoteForward", *remoteForward, "")
+	clientutils.SetConfIfNot(conf, "DynamicForward", *dynamicForward, "")
+	clientutils.SetConfIfNot(conf, "ProxyJump", *proxyJump, "")
+	clientutils.SetConfIfNot(conf, "User", *loginName, "")
+	clientutils.SetConfIfNot(conf, "KnownHostsFile", *knownHostsFile, "")
 
 	return conf
 }
 
-func updateConfigFromFile(conf *clientconfig.ClientConfig, pth string) {
-	err := config.UpdateFromFile(conf, utils.ParsePath(pth))
-	if err != nil {
-		if !os.IsNotExist(err) {
-			golog.Panicf("Error updating config from file %s: %v", pth, err)
-		}
+// exitWithStatus exits with the exit status of the remote command, if err
+// reports one.
+func exitWithStatus(err error) {
+	if exitErr, ok := err.(*gossh.ExitError); ok {
+		os.Exit(exitErr.ExitStatus())
 	}
 }
 
 func main() {
+	kingpin.Flag(pathselection.FlagSelect, pathselection.SelectUsage()).Default(pathConf.Select).StringVar(&pathConf.Select)
+	kingpin.Flag(pathselection.FlagPolicy, pathselection.PolicyUsage()).Default(pathConf.Policy).StringVar(&pathConf.Policy)
 	kingpin.Parse()
+	if *policyFile != "" || *policyName != "" || *pathSelection != "" {
+		fmt.Fprintln(os.Stderr, "Warning: --policy-file, --policy-name and --selection are deprecated, use --path-policy and --path-select")
+		if err := scionutils.ApplyLegacyPathFlags(&pathConf, *policyFile, *policyName, *pathSelection); err != nil {
+			golog.Panicf("Invalid path selection: %v", err)
+		}
+	}
 
 	conf := createConfig()
 
@@ -134,7 +103,7 @@ func main() {
 		golog.Panicf("Can't find current user: %s", err)
 	}
 
-	verifyNewKeyHandler := PromptAcceptHostKey
+	verifyNewKeyHandler := clientutils.PromptAcceptHostKey
 	if conf.StrictHostKeyChecking == "yes" {
 		verifyNewKeyHandler = func(hostname string, remote net.Addr, key string) bool {
 			return false
@@ -145,30 +114,11 @@ func main() {
 	if remoteUsername == "" {
 		remoteUsername = localUser.Username
 	}
-	var policyMap pathpol.PolicyMap
-	var policy *pathpol.Policy
-	if *policyFile != "" {
-		file, err := ioutil.ReadFile(*policyFile)
-		if err != nil {
-			golog.Panicf("Cannot read policy file: %v", err)
-		}
-		err = json.Unmarshal(file, &policyMap)
-		if err != nil {
-			golog.Panicf("Cannot unmarshal policy form file: %v", err)
-		}
-		extPolicy, policyExists := policyMap[*policyName]
-
-		if !policyExists {
-			golog.Panicf("No policy with name %s exists", *policyName)
-		}
-		policy = extPolicy.Policy
-	}
-	appConf, err := scionutils.NewPathAppConf(policy, *pathSelection)
-	if err != nil {
-		golog.Panicf("Invalid application config: %v", err)
+	if _, err := pathConf.NewSelector(); err != nil {
+		golog.Panicf("Invalid path selection: %v", err)
 	}
 
-	sshClient, err := ssh.Create(remoteUsername, conf, PromptPassword, verifyNewKeyHandler, appConf)
+	sshClient, err := ssh.Create(remoteUsername, conf, clientutils.PromptPassword, verifyNewKeyHandler, pathConf)
 	if err != nil {
 		golog.Panicf("Error creating ssh client: %v", err)
 	}
@@ -195,11 +145,41 @@ func main() {
 		}
 	}
 
+	if conf.RemoteForward != "" {
+		remoteForward := strings.SplitN(conf.RemoteForward, ":", 2)
+		if len(remoteForward) != 2 {
+			golog.Panicf("Invalid remote forwarding: %v", conf.RemoteForward)
+		}
+
+		port, err := strconv.ParseUint(remoteForward[0], 10, 16)
+		if err != nil {
+			golog.Panicf("Error parsing forwarding port: %v", err)
+		}
+
+		err = sshClient.StartRemoteTunnel(uint16(port), remoteForward[1])
+		if err != nil {
+			golog.Panicf("Error starting remote tunnel: %v", err)
+		}
+	}
+
+	if conf.DynamicForward != "" {
+		port, err := strconv.ParseUint(conf.DynamicForward, 10, 16)
+		if err != nil {
+			golog.Panicf("Error parsing forwarding port: %v", err)
+		}
+
+		err = sshClient.StartSOCKSProxy(uint16(port))
+		if err != nil {
+			golog.Panicf("Error starting SOCKS proxy: %v", err)
+		}
+	}
+
 	// TODO Don't just join those!
 	runCommand := strings.Join((*runCommand)[:], " ")
 
 	if runCommand == "" {
 		err = sshClient.Shell()
+		exitWithStatus(err)
 		if err != nil {
 			golog.Panicf("Error starting shell: %v", err)
 		}
@@ -217,6 +197,7 @@ func main() {
 		}
 
 		err = sshClient.WaitSession()
+		exitWithStatus(err)
 		if err != nil {
 			golog.Panicf("Error waiting for command to complete: %v", err)
 		}
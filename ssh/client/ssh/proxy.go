@@ -0,0 +1,175 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/netsec-ethz/scion-apps/ssh/sssh"
+)
+
+// defaultJumpPort is the port of ProxyJump hosts that do not specify one.
+const defaultJumpPort = "22"
+
+// shellSafeRegexp matches strings that need no quoting in a shell command.
+var shellSafeRegexp = regexp.MustCompile(`^[-\w.:/@+=]+$`)
+
+// iaPrefixRegexp matches a hop of a ProxyJump list that was split at the
+// comma within a SCION address, i.e. [user@]ISD-AS
+var iaPrefixRegexp = regexp.MustCompile(`^([^@]+@)?\d+-[\d:A-Fa-f]+$`)
+
+// jumpHost is a hop of a ProxyJump list.
+type jumpHost struct {
+	user string // empty for the user of the client
+	addr string // host:port
+}
+
+// dial connects to the SSH server at addr. ProxyJump takes precedence over
+// ProxyCommand, the value "none" disables either.
+func (client *Client) dial(addr string) (*ssh.Client, error) {
+	if client.proxyJump != "" && client.proxyJump != "none" {
+		return client.dialJump(addr)
+	}
+	if client.proxyCommand != "" && client.proxyCommand != "none" {
+		command := expandProxyCommand(client.proxyCommand, addr, client.config.User)
+		log.Debug("Connecting with proxy command", "command", command)
+		return sssh.DialProxyCommand(command, addr, client.config)
+	}
+	return sssh.DialSCIONWithConf(addr, client.config, client.pathConf)
+}
+
+// dialJump connects to the SSH server at addr through the ProxyJump hosts,
+// each one reached over a "direct-scionquic" tunnel through the previous one.
+// The path selection configuration only applies to the first host.
+// The connections to the jump hosts are closed once the returned client is
+// closed.
+func (client *Client) dialJump(addr string) (*ssh.Client, error) {
+	hops, err := parseProxyJump(client.proxyJump)
+	if err != nil {
+		return nil, err
+	}
+
+	var jumpClients []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			jumpClients[i].Close()
+		}
+	}
+	for i, hop := range hops {
+		config := *client.config
+		if hop.user != "" {
+			config.User = hop.user
+		}
+		log.Debug("Connecting to jump host", "address", hop.addr, "user", config.User)
+		var jumpClient *ssh.Client
+		if i == 0 {
+			jumpClient, err = sssh.DialSCIONWithConf(hop.addr, &config, client.pathConf)
+		} else {
+			jumpClient, err = sssh.DialSCIONVia(jumpClients[i-1], hop.addr, &config)
+		}
+		if err != nil {
+			closeJumps()
+			return nil, fmt.Errorf("jump host %s: %v", hop.addr, err)
+		}
+		jumpClients = append(jumpClients, jumpClient)
+	}
+
+	goClient, err := sssh.DialSCIONVia(jumpClients[len(jumpClients)-1], addr, client.config)
+	if err != nil {
+		closeJumps()
+		return nil, err
+	}
+	go func() {
+		_ = goClient.Wait()
+		closeJumps()
+	}()
+	return goClient, nil
+}
+
+// parseProxyJump parses a comma separated list of jump hosts of the form
+// [user@]host[:port], where host can be a SCION address, e.g.
+// "jump1,user@1-ffaa:0:1,[10.0.0.1]:2200".
+func parseProxyJump(proxyJump string) ([]jumpHost, error) {
+	parts := strings.Split(proxyJump, ",")
+	var hops []jumpHost
+	for i := 0; i < len(parts); i++ {
+		hop := parts[i]
+		if iaPrefixRegexp.MatchString(hop) && i+1 < len(parts) {
+			// rejoin the SCION address
+			i++
+			hop += "," + parts[i]
+		}
+
+		var user string
+		if at := strings.Index(hop, "@"); at >= 0 {
+			user, hop = hop[:at], hop[at+1:]
+		}
+		if hop == "" {
+			return nil, fmt.Errorf("invalid ProxyJump %q", proxyJump)
+		}
+		if !hasPort(hop) {
+			hop += ":" + defaultJumpPort
+		}
+		hops = append(hops, jumpHost{user: user, addr: hop})
+	}
+	return hops, nil
+}
+
+// hasPort checks whether the host name or SCION address ends with a port.
+func hasPort(host string) bool {
+	i := strings.LastIndex(host, ":")
+	if i < 0 {
+		return false
+	}
+	// ports follow the closing bracket of SCION addresses with an IP in
+	// brackets; without brackets, IPv4 and host names contain no colon after
+	// the comma of a SCION address
+	if strings.Contains(host, "]") {
+		return i > strings.LastIndex(host, "]")
+	}
+	return i > strings.LastIndex(host, ",")
+}
+
+// expandProxyCommand replaces the tokens %h (host), %p (port), %r (remote
+// user) and %% in the ProxyCommand. The substituted values are quoted for the
+// shell running the command, see shellQuote.
+func expandProxyCommand(command string, addr string, user string) string {
+	host, port := addr, defaultJumpPort
+	if i := strings.LastIndex(addr, ":"); i >= 0 && hasPort(addr) {
+		host, port = addr[:i], addr[i+1:]
+	}
+	replacer := strings.NewReplacer(
+		"%h", shellQuote(host),
+		"%p", shellQuote(port),
+		"%r", shellQuote(user),
+		"%%", "%")
+	return replacer.Replace(command)
+}
+
+// shellQuote quotes s as a single word for sh, unless it contains only
+// characters without special meaning. E.g. the brackets of SCION addresses
+// would otherwise be expanded as a glob pattern.
+func shellQuote(s string) string {
+	if shellSafeRegexp.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseProxyJump(t *testing.T) {
+	Convey("Given ProxyJump lists", t, func() {
+
+		Convey("Host names with and without user and port are parsed", func() {
+			hops, err := parseProxyJump("jump1:2200,user@jump2")
+			So(err, ShouldBeNil)
+			So(hops, ShouldResemble, []jumpHost{
+				{addr: "jump1:2200"},
+				{user: "user", addr: "jump2:22"},
+			})
+		})
+
+		Convey("SCION addresses are not split at their comma", func() {
+			hops, err := parseProxyJump("user@1-ffaa:0:1,[10.0.0.1]:2200,1-ffaa:0:2,[fd00::1],1-ffaa:0:3,10.0.0.3")
+			So(err, ShouldBeNil)
+			So(hops, ShouldResemble, []jumpHost{
+				{user: "user", addr: "1-ffaa:0:1,[10.0.0.1]:2200"},
+				{addr: "1-ffaa:0:2,[fd00::1]:22"},
+				{addr: "1-ffaa:0:3,10.0.0.3:22"},
+			})
+		})
+
+		Convey("Empty hosts are rejected", func() {
+			_, err := parseProxyJump("jump1,")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestExpandProxyCommand(t *testing.T) {
+	Convey("Tokens in the ProxyCommand are replaced", t, func() {
+		So(expandProxyCommand("nc %h %p # %r %%h", "1-ffaa:0:1,[10.0.0.1]:2200", "user"),
+			ShouldEqual, "nc '1-ffaa:0:1,[10.0.0.1]' 2200 # user %h")
+		So(expandProxyCommand("nc %h %p", "host", "user"), ShouldEqual, "nc host 22")
+		So(expandProxyCommand("ssh %r@jump nc %h %p", "$(reboot);x:22", "it's"),
+			ShouldEqual, `ssh 'it'\''s'@jump nc '$(reboot);x' 22`)
+	})
+}
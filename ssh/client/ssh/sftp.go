@@ -0,0 +1,25 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"github.com/pkg/sftp"
+)
+
+// NewSFTPClient starts the "sftp" subsystem in a new session on the server
+// this Client is connected to, and returns an SFTP client using it.
+func (client *Client) NewSFTPClient() (*sftp.Client, error) {
+	return sftp.NewClient(client.client)
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// SOCKS5 protocol constants, RFC 1928
+const (
+	socksVersion = 5
+
+	socksMethodNoAuth       = 0
+	socksMethodNoAcceptable = 0xff
+
+	socksCmdConnect = 1
+
+	socksAtypIPv4   = 1
+	socksAtypDomain = 3
+	socksAtypIPv6   = 4
+
+	socksReplySucceeded        = 0
+	socksReplyGeneralFailure   = 1
+	socksReplyHostUnreachable  = 4
+	socksReplyCmdNotSupported  = 7
+	socksReplyAtypNotSupported = 8
+)
+
+var (
+	// errSOCKSCommand is returned by readSOCKSRequest for requests other
+	// than CONNECT.
+	errSOCKSCommand = errors.New("unsupported SOCKS command")
+	// errSOCKSAddressType is returned by readSOCKSRequest for unknown
+	// address types.
+	errSOCKSAddressType = errors.New("unsupported SOCKS address type")
+	// errSOCKSAuth is returned by readSOCKSRequest if the client requires
+	// authentication. The rejection has already been sent.
+	errSOCKSAuth = errors.New("no acceptable SOCKS authentication method")
+)
+
+// StartSOCKSProxy starts a SOCKS5 proxy on the given local port, forwarding the connections over the server to the requested targets. Targets with a SCION address (passed as domain name, e.g. "1-ffaa:1:abc,[127.0.0.1]") are connected with QUIC; else TCP is used.
+func (client *Client) StartSOCKSProxy(localPort uint16) error {
+	localListener, err := net.Listen("tcp", fmt.Sprintf("localhost:%v", localPort))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer localListener.Close()
+		for {
+			localConn, err := localListener.Accept()
+			if err != nil {
+				log.Debug("Error accepting SOCKS listener: ", err)
+				return
+			}
+
+			go client.serveSOCKS(localConn)
+		}
+	}()
+
+	return nil
+}
+
+// serveSOCKS handles the SOCKS handshake on the connection and forwards it to
+// the requested target.
+func (client *Client) serveSOCKS(localConn net.Conn) {
+	addr, err := readSOCKSRequest(localConn)
+	if err != nil {
+		log.Debug("Error reading SOCKS request: ", err)
+		switch err {
+		case errSOCKSAuth:
+		case errSOCKSCommand:
+			writeSOCKSReply(localConn, socksReplyCmdNotSupported)
+		case errSOCKSAddressType:
+			writeSOCKSReply(localConn, socksReplyAtypNotSupported)
+		default:
+			writeSOCKSReply(localConn, socksReplyGeneralFailure)
+		}
+		localConn.Close()
+		return
+	}
+
+	remoteConn, err := client.Dial(addr)
+	if err != nil {
+		log.Debug("Error dialing SOCKS target", "address", addr, "error", err)
+		writeSOCKSReply(localConn, socksReplyHostUnreachable)
+		localConn.Close()
+		return
+	}
+	if err := writeSOCKSReply(localConn, socksReplySucceeded); err != nil {
+		localConn.Close()
+		remoteConn.Close()
+		return
+	}
+	pipe(localConn, remoteConn)
+}
+
+// readSOCKSRequest performs the method selection, accepting only
+// unauthenticated clients, and reads the CONNECT request, returning the
+// target address in the format accepted by Client.Dial.
+func readSOCKSRequest(conn io.ReadWriter) (string, error) {
+	header := make([]byte, 2) // version, number of methods
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(socksMethodNoAcceptable)
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			method = socksMethodNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksMethodNoAcceptable {
+		return "", errSOCKSAuth
+	}
+
+	request := make([]byte, 4) // version, command, reserved, address type
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", errSOCKSAddressType
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return "", err
+	}
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(portBytes)))
+
+	if request[1] != socksCmdConnect {
+		return "", errSOCKSCommand
+	}
+	if strings.Contains(host, ",") {
+		// SCION address, cannot use JoinHostPort as it would add brackets
+		return host + ":" + port, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// writeSOCKSReply writes a reply with the given status. The bound address is
+// not meaningful for the tunnels and always set to 0.0.0.0:0.
+func writeSOCKSReply(conn io.Writer, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// socksConn is a fake connection reading a client's messages and recording
+// the replies.
+type socksConn struct {
+	*bytes.Reader
+	bytes.Buffer
+}
+
+func (c *socksConn) Read(b []byte) (int, error) {
+	return c.Reader.Read(b)
+}
+
+func socksRequest(cmd, atyp byte, addr []byte, port uint16) *socksConn {
+	msg := []byte{socksVersion, 1, socksMethodNoAuth, socksVersion, cmd, 0, atyp}
+	msg = append(msg, addr...)
+	msg = append(msg, byte(port>>8), byte(port))
+	return &socksConn{Reader: bytes.NewReader(msg)}
+}
+
+func socksDomain(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+func TestReadSOCKSRequest(t *testing.T) {
+	Convey("Given SOCKS5 CONNECT requests", t, func() {
+
+		Convey("IP addresses are parsed", func() {
+			conn := socksRequest(socksCmdConnect, socksAtypIPv4, []byte{192, 0, 2, 1}, 80)
+			addr, err := readSOCKSRequest(conn)
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "192.0.2.1:80")
+			So(conn.Bytes(), ShouldResemble, []byte{socksVersion, socksMethodNoAuth})
+
+			ipv6 := make([]byte, 16)
+			ipv6[15] = 1
+			addr, err = readSOCKSRequest(socksRequest(socksCmdConnect, socksAtypIPv6, ipv6, 443))
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "[::1]:443")
+		})
+
+		Convey("Domain names and SCION addresses are parsed", func() {
+			addr, err := readSOCKSRequest(socksRequest(socksCmdConnect, socksAtypDomain, socksDomain("example.org"), 80))
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "example.org:80")
+
+			addr, err = readSOCKSRequest(socksRequest(socksCmdConnect, socksAtypDomain, socksDomain("1-ff00:0:110,[127.0.0.1]"), 80))
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, "1-ff00:0:110,[127.0.0.1]:80")
+		})
+
+		Convey("Other commands are rejected", func() {
+			_, err := readSOCKSRequest(socksRequest(2, socksAtypIPv4, []byte{192, 0, 2, 1}, 80))
+			So(err, ShouldEqual, errSOCKSCommand)
+		})
+
+		Convey("Clients requiring authentication are rejected", func() {
+			conn := &socksConn{Reader: bytes.NewReader([]byte{socksVersion, 1, 2})}
+			_, err := readSOCKSRequest(conn)
+			So(err, ShouldEqual, errSOCKSAuth)
+			So(conn.Bytes(), ShouldResemble, []byte{socksVersion, socksMethodNoAcceptable})
+		})
+	})
+}
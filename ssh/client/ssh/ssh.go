@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -31,10 +32,10 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	"github.com/netsec-ethz/scion-apps/ssh/client/clientconfig"
 	"github.com/netsec-ethz/scion-apps/ssh/client/ssh/knownhosts"
 	"github.com/netsec-ethz/scion-apps/ssh/quicconn"
-	"github.com/netsec-ethz/scion-apps/ssh/scionutils"
 	"github.com/netsec-ethz/scion-apps/ssh/sssh"
 	"github.com/netsec-ethz/scion-apps/ssh/utils"
 )
@@ -52,19 +53,31 @@ type Client struct {
 	knownHostsFileHandler           ssh.HostKeyCallback
 	knownHostsFilePath              string
 
-	client  *ssh.Client
-	session *ssh.Session
-	appConf *scionutils.PathAppConf
+	client   *ssh.Client
+	session  *ssh.Session
+	pathConf pathselection.Config
+	sendEnv  []string
+
+	proxyCommand string
+	proxyJump    string
+
+	// remote forwarded SCION ports and their target addresses
+	remoteForwardsMutex sync.Mutex
+	remoteForwards      map[uint32]string
 }
 
 // Create creates a new unconnected Client.
 func Create(username string, config *clientconfig.ClientConfig, passAuthHandler AuthenticationHandler,
-	verifyNewKeyHandler VerifyHostKeyHandler, appConf *scionutils.PathAppConf) (*Client, error) {
+	verifyNewKeyHandler VerifyHostKeyHandler, pathConf pathselection.Config) (*Client, error) {
 	client := &Client{
 		config: &ssh.ClientConfig{
 			User: username,
 		},
-		appConf: appConf,
+		pathConf: pathConf,
+		sendEnv:  config.SendEnv,
+
+		proxyCommand: config.ProxyCommand,
+		proxyJump:    config.ProxyJump,
 	}
 
 	var authMethods []ssh.AuthMethod
@@ -116,9 +129,10 @@ func Create(username string, config *clientconfig.ClientConfig, passAuthHandler
 	return client, nil
 }
 
-// Connect connects the Client to the given address.
+// Connect connects the Client to the given address, directly or through the
+// configured ProxyJump hosts or ProxyCommand.
 func (client *Client) Connect(addr string) error {
-	goClient, err := sssh.DialSCIONWithConf(addr, client.config, client.appConf)
+	goClient, err := client.dial(addr)
 	if err != nil {
 		return err
 	}
@@ -129,10 +143,41 @@ func (client *Client) Connect(addr string) error {
 	if err != nil {
 		return err
 	}
+	client.setEnv()
 
 	return nil
 }
 
+// setEnv sends the local environment variables matching the SendEnv patterns
+// to the session. Variables rejected by the server are ignored.
+func (client *Client) setEnv() {
+	for _, kv := range os.Environ() {
+		name, value := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			name, value = kv[:i], kv[i+1:]
+		}
+		if !matchEnvPatterns(client.sendEnv, name) {
+			continue
+		}
+		if err := client.session.Setenv(name, value); err != nil {
+			log.Debug("Environment variable not accepted", "name", name)
+		}
+	}
+}
+
+// matchEnvPatterns checks whether the variable name matches any of the
+// space separated patterns.
+func matchEnvPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		for _, pattern := range strings.Fields(p) {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // RunSession runs a terminal session, waiting for it to end.
 func (client *Client) RunSession(cmd string) error {
 	return client.session.Run(cmd)
@@ -252,6 +297,125 @@ func (client *Client) StartTunnel(localPort uint16, addr string) error {
 	return nil
 }
 
+// StartRemoteTunnel creates a new tunnel from the given port on the server to the given address, forwarding all connections to this port over the client to the given address. If the given address is a SCION address, the server listens for QUIC connections on its SCION address and QUIC is used to connect to the address; else TCP.
+func (client *Client) StartRemoteTunnel(remotePort uint16, addr string) error {
+	if strings.Contains(addr, ",") {
+		return client.startRemoteSCIONTunnel(remotePort, addr)
+	}
+
+	remoteListener, err := client.client.Listen("tcp", fmt.Sprintf("localhost:%v", remotePort))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer remoteListener.Close()
+		for {
+			remoteConn, err := remoteListener.Accept()
+			if err != nil {
+				log.Debug("Error accepting remote tunnel listener: ", err)
+				return
+			}
+
+			go func() {
+				localConn, err := net.Dial("tcp", addr)
+				if err != nil {
+					log.Debug("Error dialing forwarded address: ", err)
+					remoteConn.Close()
+					return
+				}
+				pipe(localConn, remoteConn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+func (client *Client) startRemoteSCIONTunnel(remotePort uint16, addr string) error {
+	client.remoteForwardsMutex.Lock()
+	defer client.remoteForwardsMutex.Unlock()
+
+	if client.remoteForwards == nil {
+		channels := client.client.HandleChannelOpen(sssh.ForwardedSCIONQUICChannel)
+		if channels == nil {
+			return fmt.Errorf("channel type %s already handled", sssh.ForwardedSCIONQUICChannel)
+		}
+		client.remoteForwards = make(map[uint32]string)
+		go client.handleForwardedSCION(channels)
+	}
+
+	msg := sssh.ForwardSCIONQUICMsg{Port: uint32(remotePort)}
+	ok, reply, err := client.client.SendRequest(sssh.ForwardSCIONQUICRequest, true, ssh.Marshal(&msg))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("remote port forwarding request denied")
+	}
+	if remotePort == 0 {
+		if err := ssh.Unmarshal(reply, &msg); err != nil {
+			return err
+		}
+		log.Debug("Allocated remote SCION port", "port", msg.Port)
+	}
+	client.remoteForwards[msg.Port] = addr
+
+	return nil
+}
+
+func (client *Client) handleForwardedSCION(channels <-chan ssh.NewChannel) {
+	for newChannel := range channels {
+		var data sssh.ForwardedSCIONQUICData
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &data); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, "could not parse forwarded-scionquic payload")
+			continue
+		}
+		client.remoteForwardsMutex.Lock()
+		addr, ok := client.remoteForwards[data.Port]
+		client.remoteForwardsMutex.Unlock()
+		if !ok {
+			newChannel.Reject(ssh.Prohibited, fmt.Sprintf("no forward for port %d", data.Port))
+			continue
+		}
+
+		go func(newChannel ssh.NewChannel) {
+			localConn, err := quicconn.Dial(addr)
+			if err != nil {
+				log.Debug("Error dialing forwarded address: ", err)
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				return
+			}
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				localConn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			pipe(localConn, channel)
+		}(newChannel)
+	}
+}
+
+// pipe copies data between the two connections, closing both once either
+// direction ends.
+func pipe(a, b io.ReadWriteCloser) {
+	close := func() {
+		a.Close()
+		b.Close()
+	}
+
+	var once sync.Once
+	go func() {
+		io.Copy(a, b)
+		once.Do(close)
+	}()
+	go func() {
+		io.Copy(b, a)
+		once.Do(close)
+	}()
+}
+
 // Dial dials the given address over a tunnel to the server. If the given address is a SCION address, QUIC is used; else TCP.
 func (client *Client) Dial(addr string) (net.Conn, error) {
 	if strings.Contains(addr, ",") {
@@ -31,12 +31,21 @@ type Config interface {
 
 // UpdateFromString updates the given config from the single-line configuration string.
 func UpdateFromString(conf Config, confOption string) error {
+	name, value, err := splitOption(confOption)
+	if err != nil {
+		return err
+	}
+	return Set(conf, name, value)
+}
+
+// splitOption splits a single-line configuration string into the option name
+// and value.
+func splitOption(confOption string) (string, string, error) {
 	split := regexp.MustCompile(`(.*?)\s*[\s=]\s*(.*)`).FindStringSubmatch(confOption)
 	if len(split) < 3 {
-		return fmt.Errorf("can't parse config file line: %s", confOption)
+		return "", "", fmt.Errorf("can't parse config file line: %s", confOption)
 	}
-
-	return Set(conf, split[1], split[2])
+	return split[1], split[2], nil
 }
 
 func cToString(valueA interface{}) string {
@@ -101,6 +110,8 @@ func UpdateFromFile(conf Config, path string) error {
 }
 
 // UpdateFromReader takes a reader and updates the configuration object from its contents.
+// The values of list options in the contents replace the current values, e.g.
+// the defaults, instead of being appended to them.
 func UpdateFromReader(conf Config, reader io.Reader) error {
 	lines := make([]string, 0)
 
@@ -113,8 +124,16 @@ func UpdateFromReader(conf Config, reader io.Reader) error {
 		lines = append(lines, text)
 	}
 
+	replaced := make(map[string]bool)
 	for i := len(lines) - 1; i >= 0; i-- {
-		err := UpdateFromString(conf, lines[i])
+		name, value, err := splitOption(lines[i])
+		if err == nil {
+			if !replaced[name] {
+				clearList(conf, name)
+				replaced[name] = true
+			}
+			err = Set(conf, name, value)
+		}
 		if err != nil {
 			log.Printf("Error while updating config: %v", err)
 		}
@@ -128,6 +147,14 @@ func UpdateFromReader(conf Config, reader io.Reader) error {
 	return nil
 }
 
+// clearList empties the given option of the configuration if it is a list.
+func clearList(conf Config, name string) {
+	field := reflect.ValueOf(conf).Elem().FieldByName(name)
+	if field.IsValid() && field.CanSet() && field.Kind() == reflect.Slice {
+		field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+	}
+}
+
 func parseConfigValue(confval string, tpye reflect.Type) (reflect.Value, bool, error) {
 	switch tpye.Kind() {
 	case reflect.Slice:
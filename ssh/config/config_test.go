@@ -15,6 +15,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -56,6 +57,17 @@ func TestConfig(t *testing.T) {
 			So(myStruct.A, ShouldEqual, "000000001000")
 		})
 
+		Convey("List values from a reader should replace the default", func() {
+			err := UpdateFromReader(myStruct, strings.NewReader("B xyz\nA abc\nB yes\n"))
+			So(err, ShouldEqual, nil)
+			So(myStruct.A, ShouldEqual, "abc")
+			So(myStruct.B, ShouldResemble, []string{"yes", "xyz"})
+
+			err = UpdateFromString(myStruct, "B no")
+			So(err, ShouldEqual, nil)
+			So(myStruct.B, ShouldResemble, []string{"yes", "xyz", "no"})
+		})
+
 		Convey("We should not be able to set illegal values", func() {
 			err := Set(myStruct, "A", "abcd")
 			So(err, ShouldNotEqual, nil)
@@ -15,63 +15,37 @@
 package scionutils
 
 import (
-	"errors"
-	"github.com/scionproto/scion/go/lib/pathpol"
-)
-
-// PathSelection represents a user-specified path selection mode.
-// Arbitrary: arbitrary path selection
-// Static: use the first selected path for the whole connection
-// RoundRobin: iterate through available paths in a circular fashion
-type PathSelection int
+	"fmt"
 
-// Valid PathSelection values:
-const (
-	Arbitrary PathSelection = iota
-	Static
-	RoundRobin
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 )
 
-// PathSelectionFromString parses a string into a PathSelection.
-func PathSelectionFromString(s string) (PathSelection, error) {
-	switch s {
-	case "arbitrary":
-		return Arbitrary, nil
-	case "static":
-		return Static, nil
-	case "round-robin":
-		return RoundRobin, nil
-	default:
-		return 0, errors.New("unknown path selection option")
-	}
-}
-
-// PathAppConf represents application paths configurations specified by the user using command-line arguments
-// policy: SCION path policy
-// pathSelection: path selection mode
-type PathAppConf struct {
-	policy        *pathpol.Policy
-	pathSelection PathSelection
+// legacySelections maps the values of the deprecated --selection flag to the
+// corresponding path selection strategies.
+var legacySelections = map[string]string{
+	"arbitrary":   "first",
+	"static":      "first",
+	"random":      "random",
+	"round-robin": "round-robin",
 }
 
-// NewPathAppConf constructs a PathAppConf.
-func NewPathAppConf(policy *pathpol.Policy, pathSelection string) (*PathAppConf, error) {
-	ps, err := PathSelectionFromString(pathSelection)
-	if err != nil {
-		return nil, err
+// ApplyLegacyPathFlags updates conf from the values of the deprecated
+// --policy-file, --policy-name and --selection flags. Empty values are ignored.
+func ApplyLegacyPathFlags(conf *pathselection.Config, policyFile, policyName, selection string) error {
+	if selection != "" {
+		s, ok := legacySelections[selection]
+		if !ok {
+			return fmt.Errorf("unknown path selection option %q", selection)
+		}
+		conf.Select = s
 	}
-	return &PathAppConf{
-		policy:        policy,
-		pathSelection: ps,
-	}, nil
-}
-
-// PathSelection returns the PathSelection in the configuration.
-func (c *PathAppConf) PathSelection() PathSelection {
-	return c.pathSelection
-}
-
-// Policy returns the pathpol.Policy in the configuration.
-func (c *PathAppConf) Policy() *pathpol.Policy {
-	return c.policy
+	if policyFile != "" {
+		conf.Policy = policyFile
+		if policyName != "" {
+			conf.Policy += ":" + policyName
+		}
+	} else if policyName != "" {
+		return fmt.Errorf("policy name %q given without policy file", policyName)
+	}
+	return nil
 }
@@ -20,76 +20,29 @@ import (
 	"sync"
 
 	"github.com/scionproto/scion/go/lib/addr"
-	"github.com/scionproto/scion/go/lib/pathpol"
 	"github.com/scionproto/scion/go/lib/snet"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 )
 
-// error strings
-const (
-	errNoPath = "path not found"
-)
-
-// PathSelector selects a path for a given address.
-type PathSelector interface {
-	// Reset initializes this path selector
-	Reset([]snet.Path) error
-	// Get implements the path selection logic specified in PathAppConf
-	Next() snet.Path
-}
-
-// staticPathSelector implements static path selection
-// The connection uses the same path used in the first call to WriteTo for all
-// subsequenet packets
-type staticPathSelector struct {
-	staticPath snet.Path
-}
-
-func (s *staticPathSelector) Reset(paths []snet.Path) error {
-	s.staticPath = paths[0]
-	return nil
-}
-
-func (s *staticPathSelector) Next() snet.Path {
-	return s.staticPath
-}
-
-// roundrobinPathSelector implements round-robin path selection For N
-// arbitrarily ordered paths, the ith call for WriteTo uses the (i % N)th path
-type roundRobinPathSelector struct {
-	paths        []snet.Path
-	nextKeyIndex int
-}
-
-func (s *roundRobinPathSelector) Reset(paths []snet.Path) error {
-	s.paths = paths
-	s.nextKeyIndex = s.nextKeyIndex % len(paths)
-	return nil
-}
-
-func (s *roundRobinPathSelector) Next() snet.Path {
-	path := s.paths[s.nextKeyIndex]
-	s.nextKeyIndex = (s.nextKeyIndex + 1) % len(s.paths)
-	return path
-}
-
 // policyConn is a wrapper class around snet.SCIONConn that overrides its WriteTo function,
 // so that it chooses the path on which the packet is written.
 type policyConn struct {
 	net.PacketConn
-	conf      *PathAppConf
+	conf      pathselection.Config
 	mutex     sync.Mutex
-	selectors map[addr.IA]PathSelector
+	selectors map[addr.IA]pathselection.Selector
 }
 
-// NewPolicyConn constructs a PolicyConn specified in the PathAppConf argument.
-func NewPolicyConn(c *snet.Conn, conf *PathAppConf) net.PacketConn {
+// NewPolicyConn constructs a PolicyConn choosing paths according to the
+// path selection configuration.
+func NewPolicyConn(c *snet.Conn, conf pathselection.Config) net.PacketConn {
 
 	return &policyConn{
 		PacketConn: c,
 		conf:       conf,
-		selectors:  make(map[addr.IA]PathSelector),
+		selectors:  make(map[addr.IA]pathselection.Selector),
 	}
 }
 
@@ -103,66 +56,40 @@ func (c *policyConn) WriteTo(b []byte, raddr net.Addr) (int, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	selector, err := c.getSelector(address.IA)
+	path, err := c.selectPath(address.IA)
 	if err != nil {
 		return 0, err
 	}
-	var path snet.Path
-	if selector != nil { // nil for local IA
-		path = selector.Next()
-	}
 	appnet.SetPath(address, path)
 	return c.PacketConn.WriteTo(b, address)
 }
 
-func (c *policyConn) getSelector(ia addr.IA) (PathSelector, error) {
-
-	if selector, ok := c.selectors[ia]; ok {
-		return selector, nil
-	}
-	if ia == appnet.DefNetwork().IA {
-		return nil, nil
-	}
-	selector, err := c.constructSelector(ia)
-	if err != nil {
-		return nil, err
-	}
-	c.selectors[ia] = selector
-	return selector, nil
-}
-
-func (c *policyConn) constructSelector(ia addr.IA) (PathSelector, error) {
+// selectPath chooses a path to ia from the current paths, with the selector
+// for this destination. The paths are cached and kept up to date by appnet.
+// Returns nil for the local IA.
+func (c *policyConn) selectPath(ia addr.IA) (snet.Path, error) {
 
-	selector := newSelector(c.conf.PathSelection())
-	paths, err := queryPathsFiltered(ia, c.conf.Policy())
-	if err != nil {
+	paths, err := appnet.QueryPaths(ia)
+	if err != nil || len(paths) == 0 {
 		return nil, err
 	}
-	if len(paths) == 0 {
-		return nil, errors.New(errNoPath)
-	}
-	err = selector.Reset(paths)
+	selector, err := c.selector(ia)
 	if err != nil {
 		return nil, err
 	}
-	return selector, nil
+	return selector.Select(paths)
 }
 
-func newSelector(selection PathSelection) PathSelector {
-	switch selection {
-	case RoundRobin:
-		return &roundRobinPathSelector{}
-	default:
-		// Static or Arbitrary
-		// XXX(matzf): remove Arbitrary and make Static the default?
-		return &staticPathSelector{}
+// selector returns the selector for paths to ia, creating it on first use.
+// Must be called with the mutex held.
+func (c *policyConn) selector(ia addr.IA) (pathselection.Selector, error) {
+	if selector, ok := c.selectors[ia]; ok {
+		return selector, nil
 	}
-}
-
-func queryPathsFiltered(ia addr.IA, policy *pathpol.Policy) ([]snet.Path, error) {
-	paths, err := appnet.QueryPaths(ia)
+	selector, err := c.conf.NewSelector()
 	if err != nil {
 		return nil, err
 	}
-	return policy.Filter(paths), nil
+	c.selectors[ia] = selector
+	return selector, nil
 }
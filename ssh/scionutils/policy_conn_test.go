@@ -15,37 +15,59 @@
 package scionutils
 
 import (
-	"net"
-	"reflect"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/snet"
-	"github.com/scionproto/scion/go/lib/spath"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 )
 
 //All tests in this file test the correctness of the path selection modes (round-robin, static)
 //The assumption is that path filtering has already been tested in SCIONProto
 
-func TestPolicyConn_SelectorType(t *testing.T) {
+var (
+	ia1 = addr.IA{I: 1, A: 0xff0000000110}
+	ia2 = addr.IA{I: 1, A: 0xff0000000111}
+)
+
+func TestPolicyConn_LegacySelection(t *testing.T) {
 	tables := []struct {
-		pathSelection PathSelection
-		policyConn    PathSelector
+		pathSelection string
+		selection     string
 	}{
-		{Arbitrary, &staticPathSelector{}},
-		{RoundRobin, &roundRobinPathSelector{}},
-		{Static, &staticPathSelector{}},
+		{"arbitrary", "first"},
+		{"static", "first"},
+		{"random", "random"},
+		{"round-robin", "round-robin"},
 	}
 
 	for _, table := range tables {
-		selector := newSelector(table.pathSelection)
-
-		resultType := reflect.TypeOf(selector)
-		expectedType := reflect.TypeOf(table.policyConn)
-		if resultType != expectedType {
-			t.Errorf("PolicyConnFromConfig expecting path selector type %s, got type %s", expectedType, resultType)
+		conf := pathselection.DefaultConfig()
+		err := ApplyLegacyPathFlags(&conf, "", "", table.pathSelection)
+		if err != nil {
+			t.Fatalf("ApplyLegacyPathFlags(%q) failed: %s", table.pathSelection, err)
+		}
+		if conf.Select != table.selection {
+			t.Errorf("ApplyLegacyPathFlags(%q) expecting selection %s, got %s",
+				table.pathSelection, table.selection, conf.Select)
 		}
 	}
+
+	conf := pathselection.DefaultConfig()
+	if err := ApplyLegacyPathFlags(&conf, "", "", "bogus"); err == nil {
+		t.Errorf("ApplyLegacyPathFlags(\"bogus\") did not fail")
+	}
+	if err := ApplyLegacyPathFlags(&conf, "policies.json", "foo", ""); err != nil {
+		t.Fatalf("ApplyLegacyPathFlags failed: %s", err)
+	}
+	if conf.Policy != "policies.json:foo" {
+		t.Errorf("ApplyLegacyPathFlags expecting policy policies.json:foo, got %s", conf.Policy)
+	}
 }
 
 func TestPolicyConn_StaticPathSelector(t *testing.T) {
@@ -54,12 +76,11 @@ func TestPolicyConn_StaticPathSelector(t *testing.T) {
 	const numRepetitions = 3
 	paths := makePaths(numPaths)
 
-	selector := newSelector(Static)
-	selector.Reset(paths)
+	conn := newTestPolicyConn(pathselection.Config{Select: "first"})
 
 	for i := 0; i < numRepetitions*numPaths; i++ {
 		expected := paths[0]
-		actual := selector.Next()
+		actual := selectPath(t, conn, ia1, paths)
 		if actual != expected {
 			t.Fatalf("Static path selection: Expected path %v, found path %v", expected, actual)
 		}
@@ -77,31 +98,77 @@ func TestPolicyConn_RoundRobinSelector(t *testing.T) {
 		roundRobinSeq = append(roundRobinSeq, paths...)
 	}
 
-	selector := newSelector(RoundRobin)
-	selector.Reset(paths)
+	conn := newTestPolicyConn(pathselection.Config{Select: "round-robin"})
 
 	for i := 0; i < numRepetitions*numPaths; i++ {
 		expected := roundRobinSeq[i]
-		actual := selector.Next()
+		// Interleave another destination, which must not affect the sequence.
+		selectPath(t, conn, ia2, paths)
+		actual := selectPath(t, conn, ia1, paths)
 		if actual != expected {
 			t.Fatalf("Round robin path selection: Expected path %v, found path %v", expected, actual)
 		}
 	}
 }
 
-// mockPath satisfies the snet.Path interface but does not actually implement anything.
-type mockPath struct{}
+func TestPolicyConn_Policy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy_conn_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policyFile := filepath.Join(dir, "policies.json")
+	policies := `{"no110": {"acl": ["- 1-ff00:0:110", "+"]}}`
+	if err := ioutil.WriteFile(policyFile, []byte(policies), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	via110 := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: []snet.PathInterface{{IA: ia1, ID: 1}, {IA: ia2, ID: 2}},
+	}}
+	other := &snetpath.Path{Meta: snet.PathMetadata{
+		Interfaces: []snet.PathInterface{{IA: ia2, ID: 3}, {IA: ia2, ID: 4}},
+	}}
 
-func (p *mockPath) UnderlayNextHop() *net.UDPAddr { return nil }
-func (p *mockPath) Path() spath.Path              { return spath.Path{} }
-func (p *mockPath) Destination() addr.IA          { return addr.IA{} }
-func (p *mockPath) Metadata() *snet.PathMetadata  { return nil }
-func (p *mockPath) Copy() snet.Path               { return nil }
+	conf := pathselection.Config{}
+	if err := ApplyLegacyPathFlags(&conf, policyFile, "no110", "static"); err != nil {
+		t.Fatalf("ApplyLegacyPathFlags failed: %s", err)
+	}
+	conn := newTestPolicyConn(conf)
+	actual := selectPath(t, conn, ia2, []snet.Path{via110, other})
+	if actual != other {
+		t.Errorf("Policy path selection: Expected path %v, found path %v", other, actual)
+	}
+
+	conf.Policy = policyFile + ":bogus"
+	conn = newTestPolicyConn(conf)
+	if _, err := conn.selector(ia2); err == nil {
+		t.Errorf("Policy path selection: expected error for unknown policy name")
+	}
+}
+
+func newTestPolicyConn(conf pathselection.Config) *policyConn {
+	return NewPolicyConn(nil, conf).(*policyConn)
+}
+
+func selectPath(t *testing.T, c *policyConn, ia addr.IA, paths []snet.Path) snet.Path {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	selector, err := c.selector(ia)
+	if err != nil {
+		t.Fatalf("Creating path selector failed: %s", err)
+	}
+	path, err := selector.Select(paths)
+	if err != nil {
+		t.Fatalf("Path selection failed: %s", err)
+	}
+	return path
+}
 
 func makePaths(num int) []snet.Path {
 	paths := make([]snet.Path, num)
 	for i := 0; i < num; i++ {
-		paths[i] = &mockPath{}
+		paths[i] = &snetpath.Path{}
 	}
 	return paths
 }
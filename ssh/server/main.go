@@ -73,6 +73,14 @@ func updateConfigFromFile(conf *serverconfig.ServerConfig, pth string) {
 }
 
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == ssh.SFTPServerArg {
+		// serve the sftp subsystem of a session, see ssh.RunSFTPServer
+		if err := ssh.RunSFTPServer(); err != nil {
+			golog.Fatalf("Error serving sftp: %v", err)
+		}
+		return
+	}
+
 	kingpin.Parse()
 	log.Debug("Starting SCION SSH server...")
 
@@ -0,0 +1,358 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/scionproto/scion/go/lib/snet"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/appnet/appquic"
+	"github.com/netsec-ethz/scion-apps/ssh/quicconn"
+	"github.com/netsec-ethz/scion-apps/ssh/sssh"
+)
+
+// privilegedPorts are the ports below this limit, which only root may forward.
+const privilegedPorts = 1024
+
+// tcpipForwardMsg is the payload of "tcpip-forward" and
+// "cancel-tcpip-forward" requests, RFC 4254 7.1.
+type tcpipForwardMsg struct {
+	Addr string
+	Port uint32
+}
+
+// tcpipForwardReply is the reply to a "tcpip-forward" request for port 0.
+type tcpipForwardReply struct {
+	Port uint32
+}
+
+// forwardedTCPData is the extra data of "forwarded-tcpip" channels, RFC 4254
+// 7.2.
+type forwardedTCPData struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// remoteForwards handles the remote port forwarding requests of a connection
+// and keeps track of the listeners.
+type remoteForwards struct {
+	conn         *ssh.ServerConn
+	gatewayPorts string
+	allowed      bool
+
+	mutex     sync.Mutex
+	listeners map[string]io.Closer
+}
+
+// handleGlobalRequests serves the global requests of a connection, i.e. the
+// remote port forwarding requests. The listeners are closed once the
+// connection ends.
+func (s *Server) handleGlobalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	f := &remoteForwards{
+		conn:         conn,
+		gatewayPorts: s.gatewayPorts,
+		allowed:      s.allowsForwarding("remote"),
+		listeners:    make(map[string]io.Closer),
+	}
+	defer f.closeAll()
+
+	for req := range reqs {
+		var reply []byte
+		var err error
+		switch req.Type {
+		case "tcpip-forward":
+			reply, err = f.forwardTCP(req.Payload)
+		case "cancel-tcpip-forward":
+			err = f.cancelTCP(req.Payload)
+		case sssh.ForwardSCIONQUICRequest:
+			reply, err = f.forwardSCIONQUIC(req.Payload)
+		case sssh.CancelForwardSCIONQUICRequest:
+			err = f.cancelSCIONQUIC(req.Payload)
+		default:
+			err = fmt.Errorf("unknown request type %s", req.Type)
+		}
+		if err != nil {
+			log.Debug("Global request failed", "type", req.Type, "error", err)
+		}
+
+		if req.WantReply {
+			req.Reply(err == nil, reply)
+		}
+	}
+}
+
+// forwardTCP listens for TCP connections on the requested address. Unless
+// GatewayPorts is set, only the loopback address is used.
+func (f *remoteForwards) forwardTCP(payload []byte) ([]byte, error) {
+	var msg tcpipForwardMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	if err := f.checkPort(msg.Port); err != nil {
+		return nil, err
+	}
+	bindAddr := msg.Addr
+	switch f.gatewayPorts {
+	case "yes":
+		bindAddr = ""
+	case "clientspecified":
+		if bindAddr == "localhost" {
+			bindAddr = "127.0.0.1"
+		}
+	default:
+		bindAddr = "127.0.0.1"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(int(msg.Port))))
+	if err != nil {
+		return nil, err
+	}
+	port := uint32(listener.Addr().(*net.TCPAddr).Port)
+	if err := f.add(tcpForwardKey(msg.Addr, port), listener); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	log.Debug("Forwarding remote port", "address", listener.Addr())
+	go f.serveTCP(listener, msg.Addr, port)
+
+	if msg.Port == 0 {
+		return ssh.Marshal(&tcpipForwardReply{Port: port}), nil
+	}
+	return nil, nil
+}
+
+func (f *remoteForwards) cancelTCP(payload []byte) error {
+	var msg tcpipForwardMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+	return f.remove(tcpForwardKey(msg.Addr, msg.Port))
+}
+
+// serveTCP opens a "forwarded-tcpip" channel for each connection accepted on
+// the listener, until the listener is closed.
+func (f *remoteForwards) serveTCP(listener net.Listener, addr string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Debug("Stopped forwarding remote port", "address", listener.Addr(), "error", err)
+			return
+		}
+		go func() {
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			data := forwardedTCPData{
+				Addr:       addr,
+				Port:       port,
+				OriginAddr: origin.IP.String(),
+				OriginPort: uint32(origin.Port),
+			}
+			f.openForwardedChannel("forwarded-tcpip", ssh.Marshal(&data), conn)
+		}()
+	}
+}
+
+// forwardSCIONQUIC listens for QUIC connections on the requested SCION/UDP
+// port. As SCION clients, also those in other ASes, reach this host on its
+// address in the local AS, only this address is used, unless GatewayPorts is
+// "yes", which listens on all addresses. As the request does not contain an
+// address, "clientspecified" behaves like "no".
+func (f *remoteForwards) forwardSCIONQUIC(payload []byte) ([]byte, error) {
+	var msg sssh.ForwardSCIONQUICMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	if err := f.checkPort(msg.Port); err != nil {
+		return nil, err
+	}
+	var bindIP net.IP
+	if f.gatewayPorts != "yes" {
+		var err error
+		bindIP, err = appnet.DefNetwork().DefaultLocalIP()
+		if err != nil {
+			return nil, err
+		}
+	}
+	sconn, err := appnet.Listen(&net.UDPAddr{IP: bindIP, Port: int(msg.Port)})
+	if err != nil {
+		return nil, err
+	}
+	ql, err := quic.Listen(appquic.NewReplyPathConn(sconn),
+		&tls.Config{
+			Certificates: appquic.GetDummyTLSCerts(),
+			NextProtos:   []string{quicconn.ProtoSSH},
+		},
+		nil)
+	if err != nil {
+		sconn.Close()
+		return nil, err
+	}
+	listener := &scionQUICListener{listener: ql, conn: sconn}
+	port := msg.Port
+	switch addr := sconn.LocalAddr().(type) {
+	case *snet.UDPAddr:
+		port = uint32(addr.Host.Port)
+	case *net.UDPAddr:
+		port = uint32(addr.Port)
+	}
+	if err := f.add(scionQUICForwardKey(port), listener); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	log.Debug("Forwarding remote SCION port", "address", sconn.LocalAddr())
+	go f.serveSCIONQUIC(listener, port)
+
+	if msg.Port == 0 {
+		return ssh.Marshal(&sssh.ForwardSCIONQUICMsg{Port: port}), nil
+	}
+	return nil, nil
+}
+
+func (f *remoteForwards) cancelSCIONQUIC(payload []byte) error {
+	var msg sssh.ForwardSCIONQUICMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+	return f.remove(scionQUICForwardKey(msg.Port))
+}
+
+// scionQUICListener is a QUIC listener on a SCION/UDP conn. Unlike
+// appquic.ListenStreams, it expects no stream-open header, as the ssh client
+// dials with quicconn.Dial.
+type scionQUICListener struct {
+	listener quic.Listener
+	conn     *snet.Conn
+}
+
+// Close closes the QUIC listener and the underlying conn.
+func (l *scionQUICListener) Close() error {
+	err := l.listener.Close()
+	if cerr := l.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// serveSCIONQUIC opens a sssh.ForwardedSCIONQUICChannel for the first stream
+// of each session accepted on the listener, until the listener is closed.
+func (f *remoteForwards) serveSCIONQUIC(listener *scionQUICListener, port uint32) {
+	for {
+		sess, err := listener.listener.Accept(context.Background())
+		if err != nil {
+			log.Debug("Stopped forwarding remote SCION port", "address", listener.conn.LocalAddr(), "error", err)
+			return
+		}
+		go func() {
+			stream, err := sess.AcceptStream(context.Background())
+			if err != nil {
+				_ = sess.CloseWithError(quic.ErrorCode(0), "")
+				return
+			}
+			data := sssh.ForwardedSCIONQUICData{
+				Port:       port,
+				OriginAddr: sess.RemoteAddr().String(),
+			}
+			conn := &quicconn.QuicConn{Session: sess, Stream: stream}
+			f.openForwardedChannel(sssh.ForwardedSCIONQUICChannel, ssh.Marshal(&data), conn)
+		}()
+	}
+}
+
+// checkPort checks whether remote forwarding is allowed and whether the user
+// of the connection may listen on the port.
+func (f *remoteForwards) checkPort(port uint32) error {
+	if !f.allowed {
+		return errors.New("remote port forwarding is disabled")
+	}
+	if port > 0xffff {
+		return fmt.Errorf("invalid port %d", port)
+	}
+	if port == 0 || port >= privilegedPorts {
+		return nil
+	}
+	usr, err := lookupSessionUser(f.conn.Permissions)
+	if err != nil {
+		return err
+	}
+	if usr.Uid != "0" {
+		return fmt.Errorf("only root may forward privileged port %d", port)
+	}
+	return nil
+}
+
+// openForwardedChannel opens a channel to the client for the forwarded
+// connection and copies data between the two.
+func (f *remoteForwards) openForwardedChannel(channelType string, data []byte, conn net.Conn) {
+	channel, requests, err := f.conn.OpenChannel(channelType, data)
+	if err != nil {
+		log.Debug("Could not open forwarded channel", "error", err)
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	handleTunnelForRemoteConnection(channel, conn)
+}
+
+func (f *remoteForwards) add(key string, listener io.Closer) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, exists := f.listeners[key]; exists {
+		return fmt.Errorf("already forwarding %s", key)
+	}
+	f.listeners[key] = listener
+	return nil
+}
+
+func (f *remoteForwards) remove(key string) error {
+	f.mutex.Lock()
+	listener, exists := f.listeners[key]
+	delete(f.listeners, key)
+	f.mutex.Unlock()
+	if !exists {
+		return fmt.Errorf("not forwarding %s", key)
+	}
+	return listener.Close()
+}
+
+func (f *remoteForwards) closeAll() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for key, listener := range f.listeners {
+		listener.Close()
+		delete(f.listeners, key)
+	}
+}
+
+func tcpForwardKey(addr string, port uint32) string {
+	return "tcp:" + net.JoinHostPort(addr, strconv.Itoa(int(port)))
+}
+
+func scionQUICForwardKey(port uint32) string {
+	return "scionquic:" + strconv.Itoa(int(port))
+}
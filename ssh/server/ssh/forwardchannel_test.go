@@ -0,0 +1,148 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os/user"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestClient returns a client connected to s over TCP, authenticated as
+// username, for which s serves the global requests and the channels.
+func newTestClient(t *testing.T, s *Server, username string) *ssh.Client {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConf := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			return &ssh.Permissions{CriticalOptions: map[string]string{"user": c.User()}}, nil
+		},
+	}
+	serverConf.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConf)
+		if err != nil {
+			return
+		}
+		go s.handleChannels(sconn.Permissions, chans)
+		s.handleGlobalRequests(sconn, reqs)
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.Password("")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRemoteForwarding(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given a client of a server allowing remote forwarding", t, func() {
+		s := &Server{gatewayPorts: "no", allowForwarding: "yes"}
+		client := newTestClient(t, s, current.Username)
+
+		Convey("A port is allocated, forwarded and cancelled", func() {
+			listener, err := client.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			addr := listener.Addr().(*net.TCPAddr)
+			So(addr.Port, ShouldNotEqual, 0)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+
+			conn, err := net.Dial("tcp", addr.String())
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			_, err = conn.Write([]byte("hello"))
+			So(err, ShouldBeNil)
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(conn, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, "hello")
+
+			// Close sends a "cancel-tcpip-forward" request and waits for the reply
+			So(listener.Close(), ShouldBeNil)
+			_, err = net.Dial("tcp", addr.String())
+			So(err, ShouldNotBeNil)
+
+			cancel := tcpipForwardMsg{Addr: "127.0.0.1", Port: uint32(addr.Port)}
+			ok, _, err := client.SendRequest("cancel-tcpip-forward", true, ssh.Marshal(&cancel))
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a client of a server not allowing remote forwarding", t, func() {
+		s := &Server{gatewayPorts: "no", allowForwarding: "local"}
+		client := newTestClient(t, s, current.Username)
+
+		Convey("Forwarding is refused", func() {
+			_, err := client.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a client logged in as an unprivileged user", t, func() {
+		nobody, err := user.Lookup("nobody")
+		if err != nil || nobody.Uid == "0" {
+			t.Skip("no unprivileged user nobody")
+		}
+		s := &Server{gatewayPorts: "no", allowForwarding: "yes"}
+		client := newTestClient(t, s, nobody.Username)
+
+		Convey("Privileged ports are refused", func() {
+			msg := tcpipForwardMsg{Addr: "127.0.0.1", Port: 80}
+			ok, _, err := client.SendRequest("tcpip-forward", true, ssh.Marshal(&msg))
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
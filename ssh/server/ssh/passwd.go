@@ -0,0 +1,72 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	passwdFile   = "/etc/passwd"
+	defaultShell = "/bin/sh"
+)
+
+// loginShell returns the login shell of the user from the passwd database,
+// or /bin/sh if none is set.
+// os/user does not expose the shell, so the passwd file is parsed directly.
+func loginShell(username string) string {
+	f, err := os.Open(passwdFile)
+	if err != nil {
+		return defaultShell
+	}
+	defer f.Close()
+	shell, ok := parseLoginShell(f, username)
+	if !ok || shell == "" {
+		return defaultShell
+	}
+	return shell
+}
+
+// parseLoginShell returns the shell field of the user's entry in a file in
+// passwd(5) format.
+func parseLoginShell(r io.Reader, username string) (string, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// name:password:UID:GID:GECOS:directory:shell
+		fields := strings.Split(line, ":")
+		if len(fields) == 7 && fields[0] == username {
+			return fields[6], true
+		}
+	}
+	return "", false
+}
+
+// disablesLogin checks whether the shell is one of the shells used to disable
+// logins for an account, like nologin(8) or false(1).
+func disablesLogin(shell string) bool {
+	switch filepath.Base(shell) {
+	case "nologin", "false":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseLoginShell(t *testing.T) {
+	Convey("Given a passwd file", t, func() {
+		passwd := `root:x:0:0:root:/root:/bin/bash
+# comment
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+alice:x:1000:1000:Alice,,,:/home/alice:/usr/bin/zsh
+bob:x:1001:1001::/home/bob:
+`
+
+		Convey("The shell of existing users is found", func() {
+			shell, ok := parseLoginShell(strings.NewReader(passwd), "alice")
+			So(ok, ShouldBeTrue)
+			So(shell, ShouldEqual, "/usr/bin/zsh")
+
+			shell, ok = parseLoginShell(strings.NewReader(passwd), "bob")
+			So(ok, ShouldBeTrue)
+			So(shell, ShouldEqual, "")
+		})
+
+		Convey("Unknown users are not found", func() {
+			_, ok := parseLoginShell(strings.NewReader(passwd), "mallory")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestDisablesLogin(t *testing.T) {
+	Convey("Shells disabling logins are recognized", t, func() {
+		So(disablesLogin("/usr/sbin/nologin"), ShouldBeTrue)
+		So(disablesLogin("/sbin/nologin"), ShouldBeTrue)
+		So(disablesLogin("/bin/false"), ShouldBeTrue)
+		So(disablesLogin("/bin/bash"), ShouldBeFalse)
+		So(disablesLogin(defaultShell), ShouldBeFalse)
+	})
+}
@@ -20,7 +20,10 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"unsafe"
@@ -31,7 +34,51 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
+// defaultPath is the PATH set for session commands.
+const defaultPath = "/usr/local/bin:/usr/bin:/bin"
+
+type exitStatusMsg struct {
+	Status uint32
+}
+
+type exitSignalMsg struct {
+	Signal     string
+	CoreDumped bool
+	Error      string
+	Lang       string
+}
+
+type envRequestMsg struct {
+	Name  string
+	Value string
+}
+
+type signalRequestMsg struct {
+	Signal string
+}
+
+type subsystemRequestMsg struct {
+	Name string
+}
+
+// signals maps the signal names of RFC 4254 6.10 to the signals.
+var signals = map[string]syscall.Signal{
+	"ABRT": syscall.SIGABRT,
+	"ALRM": syscall.SIGALRM,
+	"FPE":  syscall.SIGFPE,
+	"HUP":  syscall.SIGHUP,
+	"ILL":  syscall.SIGILL,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"PIPE": syscall.SIGPIPE,
+	"QUIT": syscall.SIGQUIT,
+	"SEGV": syscall.SIGSEGV,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func (s *Server) handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 	connection, requests, err := newChannel.Accept()
 	if err != nil {
 		log.Error("Could not accept channel", "error", err)
@@ -52,22 +99,16 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 	var cmdf *os.File
 	hasRequestedPty := false
 	var ptyPayload []byte
+	var env []string
 
-	execCmd := func(name string, arg ...string) error {
-		cmd := exec.Command(name, arg...)
-		username, ok := perms.CriticalOptions["user"]
-		var usr *user.User
-		if ok {
-			var err error
-			usr, err = user.Lookup(username)
-			if err != nil {
-				return err
-			}
-		} else {
-			usr, err = user.Current()
-			if err != nil {
-				return err
-			}
+	// the process of the running command, nil before it started and after it ended
+	var procMutex sync.Mutex
+	var proc *os.Process
+
+	startCmd := func(cmd *exec.Cmd) error {
+		usr, err := lookupSessionUser(perms)
+		if err != nil {
+			return err
 		}
 		uid, err := strconv.ParseUint(usr.Uid, 10, 32)
 		if err != nil {
@@ -84,18 +125,27 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 			Uid: uint32(uid),
 			Gid: uint32(gid),
 		}
+		cmd.Dir = usr.HomeDir
+		cmd.Env = []string{
+			"HOME=" + usr.HomeDir,
+			"USER=" + usr.Username,
+			"LOGNAME=" + usr.Username,
+			"SHELL=" + loginShell(usr.Username),
+			"PATH=" + defaultPath,
+		}
+		if hasRequestedPty {
+			termLen := ptyPayload[3]
+			cmd.Env = append(cmd.Env, "TERM="+string(ptyPayload[4:termLen+4]))
+		}
+		cmd.Env = append(cmd.Env, env...)
+
 		close := func() {
-			cmd.Process.Kill()
 			err := cmd.Wait()
-			if err != nil {
-				log.Error("Error waiting for bash to end", "error", err)
-			}
+			procMutex.Lock()
+			proc = nil
+			procMutex.Unlock()
 
-			tb := []byte{0, 0, 0, 0}
-			_, err = connection.SendRequest("exit-status", false, tb)
-			if err != nil {
-				log.Error("Error sending exit status", "error", err)
-			}
+			sendExitStatus(connection, err)
 
 			once.Do(closeConn)
 
@@ -109,16 +159,16 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 				return err
 			}
 
-			var once sync.Once
-			go func() {
-				_, err := io.Copy(connection, cmdf)
+			// the output ends when the process exits, input may end earlier
+			go func(f *os.File) {
+				_, err := io.Copy(connection, f)
 				log.Debug("Pty to connection copy ended", "error", err)
-				once.Do(close)
-			}()
+				close()
+				f.Close()
+			}(cmdf)
 			go func() {
 				_, err := io.Copy(cmdf, connection)
 				log.Debug("Connection to pty copy ended", "error", err)
-				once.Do(close)
 			}()
 
 			termLen := ptyPayload[3]
@@ -151,6 +201,7 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 			go func() {
 				_, err := io.Copy(stdin, connection)
 				log.Debug("Stdin copy ended", "error", err)
+				stdin.Close()
 			}()
 			go func() {
 				_, err := io.Copy(connection, stdout)
@@ -169,23 +220,30 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 			}
 		}
 
+		procMutex.Lock()
+		proc = cmd.Process
+		procMutex.Unlock()
+
 		return nil
 	}
 
+	execCmd := func(name string, arg ...string) error {
+		return startCmd(exec.Command(name, arg...))
+	}
+
 	// Sessions have out-of-band requests such as "shell", "pty-req" and "exec"
 	go func() {
 		defer once.Do(closeConn)
 		for req := range requests {
 			switch req.Type {
 			case "shell":
-				// TODO determine and use default shell, don't force bash
-				err := execCmd("bash")
+				err := startLoginShell(perms, startCmd)
 				if err != nil {
 					log.Error("Can't create shell!", "error", err)
 				}
 
 				if req.WantReply {
-					req.Reply(true, nil)
+					req.Reply(err == nil, nil)
 				}
 			case "pty-req":
 				hasRequestedPty = true
@@ -203,24 +261,157 @@ func handleSession(perms *ssh.Permissions, newChannel ssh.NewChannel) {
 						req.Reply(true, nil)
 					}
 				}
+			case "env":
+				var msg envRequestMsg
+				ok := ssh.Unmarshal(req.Payload, &msg) == nil && s.acceptEnv(msg.Name)
+				if ok {
+					env = append(env, msg.Name+"="+msg.Value)
+				} else {
+					log.Debug("Rejected environment variable", "name", msg.Name)
+				}
+
+				if req.WantReply {
+					req.Reply(ok, nil)
+				}
+			case "signal":
+				var msg signalRequestMsg
+				err := ssh.Unmarshal(req.Payload, &msg)
+				if err == nil {
+					sig, ok := signals[msg.Signal]
+					procMutex.Lock()
+					if ok && proc != nil {
+						err = proc.Signal(sig)
+					}
+					procMutex.Unlock()
+				}
+				if err != nil {
+					log.Debug("Could not deliver signal", "signal", msg.Signal, "error", err)
+				}
 			case "exec":
 				cmdStrLen := binary.BigEndian.Uint32(req.Payload[0:4])
 				cmdStr := string(req.Payload[4 : cmdStrLen+4])
-				err := execCmd("bash", "-c", cmdStr)
+				err := startUserShellCmd(perms, execCmd, cmdStr)
 				if err != nil {
 					log.Error("Can't create shell!", "error", err)
 				}
 
 				if req.WantReply {
-					req.Reply(true, nil)
+					req.Reply(err == nil, nil)
+				}
+			case "subsystem":
+				var msg subsystemRequestMsg
+				ok := false
+				if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+					log.Debug("Invalid subsystem request", "error", err)
+				} else if msg.Name == "sftp" {
+					// subsystems speak binary protocols, which a pty would mangle
+					hasRequestedPty = false
+					err := startSFTPServer(perms, execCmd)
+					if err != nil {
+						log.Error("Can't start sftp server!", "error", err)
+					}
+					ok = err == nil
+				} else {
+					log.Debug("Unknown subsystem", "name", msg.Name)
+				}
+
+				if req.WantReply {
+					req.Reply(ok, nil)
 				}
 			default:
 				log.Debug("Unknown session request type %s", req.Type)
 			}
 		}
+
+		// the channel was closed, hang up the command if it is still running
+		procMutex.Lock()
+		if proc != nil {
+			proc.Signal(syscall.SIGHUP)
+		}
+		procMutex.Unlock()
 	}()
 }
 
+// lookupSessionUser returns the authenticated user, or the user running the
+// server if not set.
+func lookupSessionUser(perms *ssh.Permissions) (*user.User, error) {
+	username, ok := perms.CriticalOptions["user"]
+	if ok {
+		return user.Lookup(username)
+	}
+	return user.Current()
+}
+
+// startLoginShell starts the user's shell as a login shell.
+func startLoginShell(perms *ssh.Permissions, startCmd func(cmd *exec.Cmd) error) error {
+	usr, err := lookupSessionUser(perms)
+	if err != nil {
+		return err
+	}
+	shell := loginShell(usr.Username)
+	cmd := exec.Command(shell)
+	// a leading dash in argv[0] makes the shell a login shell
+	cmd.Args[0] = "-" + filepath.Base(shell)
+	return startCmd(cmd)
+}
+
+// startUserShellCmd runs the command string with the user's shell.
+func startUserShellCmd(perms *ssh.Permissions, execCmd func(name string, arg ...string) error,
+	cmdStr string) error {
+
+	usr, err := lookupSessionUser(perms)
+	if err != nil {
+		return err
+	}
+	return execCmd(loginShell(usr.Username), "-c", cmdStr)
+}
+
+// acceptEnv checks whether the environment variable may be set by the client,
+// according to the AcceptEnv patterns.
+func (s *Server) acceptEnv(name string) bool {
+	for _, patterns := range s.acceptEnvPatterns {
+		for _, pattern := range strings.Fields(patterns) {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendExitStatus sends the "exit-status" or, if the command was killed by a
+// signal, the "exit-signal" request for the result of cmd.Wait.
+func sendExitStatus(connection ssh.Channel, waitErr error) {
+	status := exitStatusMsg{}
+	if exitErr, ok := waitErr.(*exec.ExitError); ok {
+		ws, ok := exitErr.Sys().(syscall.WaitStatus)
+		if ok && ws.Signaled() {
+			for name, sig := range signals {
+				if sig == ws.Signal() {
+					msg := exitSignalMsg{Signal: name, CoreDumped: ws.CoreDump()}
+					_, err := connection.SendRequest("exit-signal", false, ssh.Marshal(&msg))
+					if err != nil {
+						log.Error("Error sending exit signal", "error", err)
+					}
+					return
+				}
+			}
+			// not a standard signal name, report like a shell
+			status.Status = 128 + uint32(ws.Signal())
+		} else {
+			status.Status = uint32(exitErr.ExitCode())
+		}
+	} else if waitErr != nil {
+		log.Error("Error waiting for command to end", "error", waitErr)
+		status.Status = 255
+	}
+
+	_, err := connection.SendRequest("exit-status", false, ssh.Marshal(&status))
+	if err != nil {
+		log.Error("Error sending exit status", "error", err)
+	}
+}
+
 // parseDims extracts terminal dimensions (width x height) from the provided buffer.
 func parseDims(b []byte) (uint32, uint32) {
 	w := binary.BigEndian.Uint32(b)
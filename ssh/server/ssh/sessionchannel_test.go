@@ -0,0 +1,148 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAcceptEnv(t *testing.T) {
+	Convey("Given a server accepting some environment variables", t, func() {
+		s := &Server{acceptEnvPatterns: []string{"LANG LC_*", "FOO"}}
+
+		Convey("Matching variables are accepted", func() {
+			So(s.acceptEnv("LANG"), ShouldBeTrue)
+			So(s.acceptEnv("LC_ALL"), ShouldBeTrue)
+			So(s.acceptEnv("FOO"), ShouldBeTrue)
+		})
+
+		Convey("Other variables are refused", func() {
+			So(s.acceptEnv("LANGUAGE"), ShouldBeFalse)
+			So(s.acceptEnv("PATH"), ShouldBeFalse)
+			So(s.acceptEnv("LD_PRELOAD"), ShouldBeFalse)
+		})
+	})
+}
+
+// requestRecorder is a ssh.Channel that records the requests sent on it.
+type requestRecorder struct {
+	ssh.Channel
+	requests []*ssh.Request
+}
+
+func (r *requestRecorder) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	r.requests = append(r.requests, &ssh.Request{Type: name, WantReply: wantReply, Payload: payload})
+	return true, nil
+}
+
+func TestSendExitStatus(t *testing.T) {
+	Convey("Given the results of commands", t, func() {
+		run := func(cmd *exec.Cmd) *requestRecorder {
+			r := &requestRecorder{}
+			sendExitStatus(r, cmd.Run())
+			So(r.requests, ShouldHaveLength, 1)
+			return r
+		}
+
+		Convey("A successful command reports status 0", func() {
+			r := run(exec.Command("true"))
+			So(r.requests[0].Type, ShouldEqual, "exit-status")
+			var msg exitStatusMsg
+			So(ssh.Unmarshal(r.requests[0].Payload, &msg), ShouldBeNil)
+			So(msg.Status, ShouldEqual, 0)
+		})
+
+		Convey("A failing command reports its exit status", func() {
+			r := run(exec.Command("sh", "-c", "exit 3"))
+			So(r.requests[0].Type, ShouldEqual, "exit-status")
+			var msg exitStatusMsg
+			So(ssh.Unmarshal(r.requests[0].Payload, &msg), ShouldBeNil)
+			So(msg.Status, ShouldEqual, 3)
+		})
+
+		Convey("A command killed by a standard signal reports the signal name", func() {
+			r := run(exec.Command("sh", "-c", "kill -TERM $$"))
+			So(r.requests[0].Type, ShouldEqual, "exit-signal")
+			var msg exitSignalMsg
+			So(ssh.Unmarshal(r.requests[0].Payload, &msg), ShouldBeNil)
+			So(msg.Signal, ShouldEqual, "TERM")
+		})
+
+		Convey("A command killed by another signal reports the status like a shell", func() {
+			cmd := exec.Command("sleep", "10")
+			So(cmd.Start(), ShouldBeNil)
+			So(cmd.Process.Signal(syscall.Signal(40)), ShouldBeNil)
+			r := &requestRecorder{}
+			sendExitStatus(r, cmd.Wait())
+			So(r.requests, ShouldHaveLength, 1)
+			So(r.requests[0].Type, ShouldEqual, "exit-status")
+			var msg exitStatusMsg
+			So(ssh.Unmarshal(r.requests[0].Payload, &msg), ShouldBeNil)
+			So(msg.Status, ShouldEqual, 128+40)
+		})
+	})
+}
+
+func TestSession(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("commands are started with the credentials of the user, which requires root")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("Given a session of a server accepting LANG", t, func() {
+		s := &Server{acceptEnvPatterns: []string{"LANG"}}
+		s.channelHandlers = map[string]ChannelHandlerFunction{"session": s.handleSession}
+		client := newTestClient(t, s, current.Username)
+		session, err := client.NewSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+
+		Convey("Only accepted environment variables are set", func() {
+			So(session.Setenv("LANG", "C.test"), ShouldBeNil)
+			So(session.Setenv("LD_PRELOAD", "evil.so"), ShouldNotBeNil)
+			out, err := session.Output("echo $LANG:$LD_PRELOAD")
+			So(err, ShouldBeNil)
+			So(strings.TrimSpace(string(out)), ShouldEqual, "C.test:")
+		})
+
+		Convey("The exit status is reported", func() {
+			err := session.Run("exit 3")
+			exitErr, ok := err.(*ssh.ExitError)
+			So(ok, ShouldBeTrue)
+			So(exitErr.ExitStatus(), ShouldEqual, 3)
+		})
+
+		Convey("Signals are delivered to the command", func() {
+			// the reply to the exec request is sent once the command started
+			So(session.Start("exec sleep 10"), ShouldBeNil)
+			So(session.Signal(ssh.SIGUSR1), ShouldBeNil)
+			err := session.Wait()
+			exitErr, ok := err.(*ssh.ExitError)
+			So(ok, ShouldBeTrue)
+			So(exitErr.Signal(), ShouldEqual, "USR1")
+		})
+	})
+}
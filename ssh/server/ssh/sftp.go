@@ -0,0 +1,135 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPServerArg is the command line argument with which the server binary is
+// re-executed to serve the "sftp" subsystem, see RunSFTPServer.
+const SFTPServerArg = "--sftp-server"
+
+// startSFTPServer starts the sftp subsystem for a session.
+// The server binary is re-executed with SFTPServerArg, using execCmd, so that
+// the sftp server runs with the credentials of the authenticated user.
+// As the login shell is bypassed, the subsystem is refused for users whose
+// shell does not permit logins, see disablesLogin. The server binary must be
+// executable by the user, which is checked before.
+func startSFTPServer(perms *ssh.Permissions, execCmd func(name string, arg ...string) error) error {
+	usr, err := lookupSessionUser(perms)
+	if err != nil {
+		return err
+	}
+	if shell := loginShell(usr.Username); disablesLogin(shell) {
+		return fmt.Errorf("login shell %s of user %s does not permit login", shell, usr.Username)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(usr.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	if err := checkExecutable(exe, uint32(uid), uint32(gid)); err != nil {
+		return fmt.Errorf("server binary cannot be executed by user %s: %w", usr.Username, err)
+	}
+	return execCmd(exe, SFTPServerArg)
+}
+
+// checkExecutable checks whether a process with the given uid and gid, and
+// no supplementary groups, may execute the file at path, i.e. whether the
+// file and all directories leading to it grant the execute permission.
+func checkExecutable(path string, uid, gid uint32) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !mayExecute(fi, uid, gid) {
+			return fmt.Errorf("permission denied: %s", p)
+		}
+		if p == filepath.Dir(p) {
+			return nil
+		}
+	}
+}
+
+// mayExecute returns whether the mode of fi grants the execute (or, for
+// directories, search) permission to uid and gid.
+func mayExecute(fi os.FileInfo, uid, gid uint32) bool {
+	perm := fi.Mode().Perm()
+	if uid == 0 {
+		// root may search all directories and execute files with any x bit
+		return fi.IsDir() || perm&0111 != 0
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	switch {
+	case st.Uid == uid:
+		return perm&0100 != 0
+	case st.Gid == gid:
+		return perm&0010 != 0
+	default:
+		return perm&0001 != 0
+	}
+}
+
+// RunSFTPServer serves the SFTP protocol on stdin and stdout, in the home
+// directory of the current user. It returns when the client closes the
+// connection.
+func RunSFTPServer() error {
+	usr, err := user.Current()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(usr.HomeDir); err != nil {
+		return err
+	}
+
+	stdio := struct {
+		io.Reader
+		io.WriteCloser
+	}{os.Stdin, os.Stdout}
+	server, err := sftp.NewServer(stdio)
+	if err != nil {
+		return err
+	}
+	err = server.Serve()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckExecutable(t *testing.T) {
+	Convey("Given an executable in a private directory", t, func() {
+		dir, err := ioutil.TempDir("", "sftp-test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		exe := filepath.Join(dir, "server")
+		So(ioutil.WriteFile(exe, nil, 0755), ShouldBeNil)
+		So(os.Chmod(dir, 0700), ShouldBeNil)
+
+		fi, err := os.Stat(dir)
+		So(err, ShouldBeNil)
+		st := fi.Sys().(*syscall.Stat_t)
+		uid, gid := st.Uid, st.Gid
+		other := uid + 12345
+
+		Convey("The owner and root may execute it", func() {
+			So(checkExecutable(exe, uid, gid), ShouldBeNil)
+			So(checkExecutable(exe, 0, 0), ShouldBeNil)
+		})
+
+		Convey("Other users may not search the directory", func() {
+			So(checkExecutable(exe, other, other), ShouldNotBeNil)
+		})
+
+		Convey("Other users may execute it once the directory is searchable", func() {
+			So(os.Chmod(dir, 0711), ShouldBeNil)
+			So(checkExecutable(exe, other, other), ShouldBeNil)
+
+			So(os.Chmod(exe, 0750), ShouldBeNil)
+			So(checkExecutable(exe, other, other), ShouldNotBeNil)
+			So(checkExecutable(exe, other, gid), ShouldBeNil)
+		})
+	})
+}
@@ -24,6 +24,7 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
 	"github.com/netsec-ethz/scion-apps/ssh/server/serverconfig"
 	"github.com/netsec-ethz/scion-apps/ssh/utils"
 )
@@ -34,6 +35,9 @@ type ChannelHandlerFunction func(perms *ssh.Permissions, newChannel ssh.NewChann
 // Server is a struct containing information about SSH servers.
 type Server struct {
 	authorizedKeysFile string
+	gatewayPorts       string
+	allowForwarding    string
+	acceptEnvPatterns  []string
 
 	configuration *ssh.ServerConfig
 
@@ -44,6 +48,9 @@ type Server struct {
 func Create(config *serverconfig.ServerConfig, version string) (*Server, error) {
 	server := &Server{
 		authorizedKeysFile: config.AuthorizedKeysFile,
+		gatewayPorts:       config.GatewayPorts,
+		allowForwarding:    config.AllowTcpForwarding,
+		acceptEnvPatterns:  config.AcceptEnv,
 		channelHandlers:    make(map[string]ChannelHandlerFunction),
 	}
 
@@ -65,13 +72,35 @@ func Create(config *serverconfig.ServerConfig, version string) (*Server, error)
 	}
 	server.configuration.AddHostKey(private)
 
-	server.channelHandlers["session"] = handleSession
-	server.channelHandlers["direct-tcpip"] = handleTCPTunnel
-	server.channelHandlers["direct-scionquic"] = handleSCIONQUICTunnel
+	server.channelHandlers["session"] = server.handleSession
+	if server.allowsForwarding("local") {
+		server.channelHandlers["direct-tcpip"] = handleTCPTunnel
+		server.channelHandlers["direct-scionquic"] = handleSCIONQUICTunnel
+	} else {
+		server.channelHandlers["direct-tcpip"] = rejectForwarding
+		server.channelHandlers["direct-scionquic"] = rejectForwarding
+	}
 
 	return server, nil
 }
 
+// allowsForwarding checks whether AllowTcpForwarding permits port forwarding
+// in the direction, "local" or "remote". It applies to forwarding of both TCP
+// and QUIC over SCION.
+func (s *Server) allowsForwarding(direction string) bool {
+	switch s.allowForwarding {
+	case "", "yes", "all":
+		return true
+	case "no":
+		return false
+	}
+	return s.allowForwarding == direction
+}
+
+func rejectForwarding(perms *ssh.Permissions, newChannel ssh.NewChannel) {
+	newChannel.Reject(ssh.Prohibited, "port forwarding is disabled")
+}
+
 func (s *Server) handleChannels(perms *ssh.Permissions, chans <-chan ssh.NewChannel) {
 	// Service the incoming Channel channel in go routine
 	for newChannel := range chans {
@@ -98,9 +127,9 @@ func (s *Server) HandleConnection(conn net.Conn) error {
 		return err
 	}
 
-	log.Debug("New SSH connection", "remoteAddress", sshConn.RemoteAddr(), "clientVersion", sshConn.ClientVersion())
-	// Discard all global out-of-band Requests
-	go ssh.DiscardRequests(reqs)
+	log.Debug("New SSH connection", "remoteAddress", appnet.FormatAddr(sshConn.RemoteAddr()), "clientVersion", sshConn.ClientVersion())
+	// Serve global out-of-band Requests, i.e. remote port forwarding
+	go s.handleGlobalRequests(sshConn, reqs)
 	// Accept all channels
 	s.handleChannels(sshConn.Permissions, chans)
 
@@ -0,0 +1,337 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// scion-sftp is an interactive file transfer client for the "sftp" subsystem
+// of the SCION SSH server, analogous to OpenSSH's sftp.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	golog "log"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
+	"github.com/netsec-ethz/scion-apps/ssh/client/clientconfig"
+	"github.com/netsec-ethz/scion-apps/ssh/client/clientutils"
+	"github.com/netsec-ethz/scion-apps/ssh/client/ssh"
+)
+
+var (
+	// Connection
+	destination = kingpin.Arg("destination", "Server SCION address (without the port), optionally prefixed with user@").Required().String()
+	port        = kingpin.Flag("port", "The server's port").Default("0").Short('P').Uint16()
+	options     = kingpin.Flag("option", "Set an option").Short('o').Strings()
+	configFiles = kingpin.Flag("config", "Configuration files").Short('c').Default("/etc/ssh/ssh_config", "~/.ssh/config").Strings()
+	batchFile   = kingpin.Flag("batch", "Read commands from file instead of stdin").Short('b').ExistingFile()
+
+	knownHostsFile = kingpin.Flag("known-hosts", "File where known hosts are stored").ExistingFile()
+	identityFile   = kingpin.Flag("identity", "Identity (private key) file").Short('i').ExistingFile()
+
+	// Path selection, flags are registered in main
+	pathConf = pathselection.DefaultConfig()
+)
+
+const helpText = `Available commands:
+  cd path                  Change remote directory to 'path'
+  lcd path                 Change local directory to 'path'
+  get remote [local]       Download file
+  put local [remote]       Upload file
+  ls [path]                List remote directory
+  lls [path]               List local directory
+  mkdir path               Create remote directory
+  rmdir path               Remove remote directory
+  rm path                  Remove remote file
+  rename oldpath newpath   Rename remote file
+  pwd                      Print remote working directory
+  lpwd                     Print local working directory
+  help                     Show this help
+  exit, quit, bye          Quit sftp
+`
+
+func createConfig(hostAddress string) *clientconfig.ClientConfig {
+	conf := clientutils.CreateConfig(*configFiles, *options)
+
+	clientutils.SetConfIfNot(conf, "Port", *port, 0)
+	clientutils.SetConfIfNot(conf, "HostAddress", hostAddress, "")
+	clientutils.SetConfIfNot(conf, "IdentityFile", *identityFile, "")
+	clientutils.SetConfIfNot(conf, "KnownHostsFile", *knownHostsFile, "")
+
+	return conf
+}
+
+func main() {
+	kingpin.Flag(pathselection.FlagSelect, pathselection.SelectUsage()).Default(pathConf.Select).StringVar(&pathConf.Select)
+	kingpin.Flag(pathselection.FlagPolicy, pathselection.PolicyUsage()).Default(pathConf.Policy).StringVar(&pathConf.Policy)
+	kingpin.Parse()
+
+	remoteUsername, hostAddress := "", *destination
+	if i := strings.Index(hostAddress, "@"); i >= 0 {
+		remoteUsername, hostAddress = hostAddress[:i], hostAddress[i+1:]
+	}
+	conf := createConfig(hostAddress)
+
+	if remoteUsername == "" {
+		remoteUsername = conf.User
+	}
+	if remoteUsername == "" {
+		localUser, err := user.Current()
+		if err != nil {
+			golog.Panicf("Can't find current user: %s", err)
+		}
+		remoteUsername = localUser.Username
+	}
+
+	verifyNewKeyHandler := clientutils.PromptAcceptHostKey
+	if conf.StrictHostKeyChecking == "yes" {
+		verifyNewKeyHandler = func(hostname string, remote net.Addr, key string) bool {
+			return false
+		}
+	}
+	if _, err := pathConf.NewSelector(); err != nil {
+		golog.Panicf("Invalid path selection: %v", err)
+	}
+
+	sshClient, err := ssh.Create(remoteUsername, conf, clientutils.PromptPassword, verifyNewKeyHandler, pathConf)
+	if err != nil {
+		golog.Panicf("Error creating ssh client: %v", err)
+	}
+
+	err = sshClient.Connect(fmt.Sprintf("%s:%v", conf.HostAddress, conf.Port))
+	if err != nil {
+		golog.Panicf("Error connecting: %v", err)
+	}
+	defer sshClient.CloseSession()
+
+	client, err := sshClient.NewSFTPClient()
+	if err != nil {
+		golog.Panicf("Error starting sftp: %v", err)
+	}
+	defer client.Close()
+
+	input := os.Stdin
+	interactive := terminal.IsTerminal(int(os.Stdin.Fd()))
+	if *batchFile != "" {
+		input, err = os.Open(*batchFile)
+		if err != nil {
+			golog.Panicf("Error opening batch file: %v", err)
+		}
+		defer input.Close()
+		interactive = false
+	}
+
+	s := &session{client: client}
+	if err := s.run(input, interactive); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// session executes sftp commands on the client.
+type session struct {
+	client *sftp.Client
+	cwd    string // remote working directory
+}
+
+// run executes the commands read from input, one per line. In interactive
+// mode, a prompt is shown and errors do not abort the session.
+func (s *session) run(input io.Reader, interactive bool) error {
+	cwd, err := s.client.Getwd()
+	if err != nil {
+		return err
+	}
+	s.cwd = cwd
+
+	scanner := bufio.NewScanner(input)
+	for {
+		if interactive {
+			fmt.Print("sftp> ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" || args[0] == "bye" {
+			return nil
+		}
+		if err := s.execute(args[0], args[1:]); err != nil {
+			if !interactive {
+				return fmt.Errorf("%s: %v", args[0], err)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		}
+	}
+}
+
+func (s *session) execute(cmd string, args []string) error {
+	nargs := map[string][2]int{ // minimum and maximum number of arguments
+		"cd": {1, 1}, "lcd": {1, 1}, "get": {1, 2}, "put": {1, 2},
+		"ls": {0, 1}, "lls": {0, 1}, "mkdir": {1, 1}, "rmdir": {1, 1}, "rm": {1, 1},
+		"rename": {2, 2}, "pwd": {0, 0}, "lpwd": {0, 0}, "help": {0, 0},
+	}
+	n, ok := nargs[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command, see help")
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		return fmt.Errorf("invalid number of arguments, see help")
+	}
+
+	switch cmd {
+	case "cd":
+		dir := s.remotePath(args[0])
+		info, err := s.client.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		s.cwd = dir
+	case "lcd":
+		return os.Chdir(args[0])
+	case "get":
+		local := path.Base(args[0])
+		if len(args) > 1 {
+			local = args[1]
+		}
+		return s.get(s.remotePath(args[0]), local)
+	case "put":
+		remote := filepath.Base(args[0])
+		if len(args) > 1 {
+			remote = args[1]
+		}
+		return s.put(args[0], s.remotePath(remote))
+	case "ls":
+		dir := s.cwd
+		if len(args) > 0 {
+			dir = s.remotePath(args[0])
+		}
+		entries, err := s.client.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		printEntries(entries)
+	case "lls":
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		entries, err := readLocalDir(dir)
+		if err != nil {
+			return err
+		}
+		printEntries(entries)
+	case "mkdir":
+		return s.client.Mkdir(s.remotePath(args[0]))
+	case "rmdir":
+		return s.client.RemoveDirectory(s.remotePath(args[0]))
+	case "rm":
+		return s.client.Remove(s.remotePath(args[0]))
+	case "rename":
+		return s.client.Rename(s.remotePath(args[0]), s.remotePath(args[1]))
+	case "pwd":
+		fmt.Printf("Remote working directory: %s\n", s.cwd)
+	case "lpwd":
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Local working directory: %s\n", wd)
+	case "help":
+		fmt.Print(helpText)
+	}
+	return nil
+}
+
+// remotePath returns the remote path p, relative to the remote working
+// directory.
+func (s *session) remotePath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(s.cwd, p)
+}
+
+func (s *session) get(remote, local string) error {
+	src, err := s.client.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	dst, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Fetching %s to %s\n", remote, local)
+	if _, err := src.WriteTo(dst); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (s *session) put(local, remote string) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if info, err := s.client.Stat(remote); err == nil && info.IsDir() {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+	dst, err := s.client.Create(remote)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Uploading %s to %s\n", local, remote)
+	if _, err := dst.ReadFrom(src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func readLocalDir(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
+
+func printEntries(entries []os.FileInfo) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		fmt.Printf("%s %10d %s %s\n", e.Mode(), e.Size(), e.ModTime().Format("Jan _2 15:04"), e.Name())
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newPipeSession returns a session with a client connected to an sftp server
+// over a pipe, with the remote working directory dir.
+func newPipeSession(t *testing.T, dir string) *session {
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = server.Serve()
+		server.Close()
+	}()
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &session{client: client, cwd: dir}
+}
+
+func TestSessionGetPut(t *testing.T) {
+	Convey("Given a session with a local and a remote directory", t, func() {
+		local := t.TempDir()
+		remote := t.TempDir()
+		s := newPipeSession(t, remote)
+		content := []byte("hello over sftp")
+		So(ioutil.WriteFile(filepath.Join(local, "file"), content, 0600), ShouldBeNil)
+
+		Convey("put uploads the file", func() {
+			So(s.put(filepath.Join(local, "file"), s.remotePath("uploaded")), ShouldBeNil)
+			b, err := ioutil.ReadFile(filepath.Join(remote, "uploaded"))
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, content)
+		})
+
+		Convey("put into a directory keeps the name", func() {
+			So(os.Mkdir(filepath.Join(remote, "dir"), 0700), ShouldBeNil)
+			So(s.put(filepath.Join(local, "file"), s.remotePath("dir")), ShouldBeNil)
+			b, err := ioutil.ReadFile(filepath.Join(remote, "dir", "file"))
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, content)
+		})
+
+		Convey("get downloads the file", func() {
+			So(ioutil.WriteFile(filepath.Join(remote, "remote"), content, 0600), ShouldBeNil)
+			So(s.get(s.remotePath("remote"), filepath.Join(local, "downloaded")), ShouldBeNil)
+			b, err := ioutil.ReadFile(filepath.Join(local, "downloaded"))
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, content)
+
+			So(s.get(s.remotePath("remote"), local), ShouldBeNil)
+			b, err = ioutil.ReadFile(filepath.Join(local, "remote"))
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, content)
+		})
+
+		Convey("get of a missing file fails", func() {
+			So(s.get(s.remotePath("missing"), filepath.Join(local, "missing")), ShouldNotBeNil)
+		})
+	})
+}
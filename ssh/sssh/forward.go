@@ -0,0 +1,43 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sssh
+
+// Remote forwarding of QUIC connections over SCION, analogous to the
+// "tcpip-forward" global request and "forwarded-tcpip" channels of RFC 4254.
+const (
+	// ForwardSCIONQUICRequest is the global request asking the server to
+	// listen for QUIC connections on a SCION/UDP port. The payload is a
+	// ForwardSCIONQUICMsg; if the port is 0, the server replies with a
+	// ForwardSCIONQUICMsg containing the allocated port.
+	ForwardSCIONQUICRequest = "scionquic-forward"
+	// CancelForwardSCIONQUICRequest is the global request to stop listening
+	// on a port, with a ForwardSCIONQUICMsg payload.
+	CancelForwardSCIONQUICRequest = "cancel-scionquic-forward"
+	// ForwardedSCIONQUICChannel is the channel opened by the server for each
+	// connection accepted on a forwarded port, with ForwardedSCIONQUICData.
+	ForwardedSCIONQUICChannel = "forwarded-scionquic"
+)
+
+// ForwardSCIONQUICMsg is the payload of the ForwardSCIONQUICRequest and
+// CancelForwardSCIONQUICRequest global requests.
+type ForwardSCIONQUICMsg struct {
+	Port uint32
+}
+
+// ForwardedSCIONQUICData is the extra data of ForwardedSCIONQUICChannel.
+type ForwardedSCIONQUICData struct {
+	Port       uint32 // the port on which the connection was accepted
+	OriginAddr string // the SCION address of the originator
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sssh
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+)
+
+// DialSCIONVia starts a client connection to the SSH server at addr, tunneled
+// over a "direct-scionquic" channel of an existing connection, e.g. to a
+// bastion host.
+func DialSCIONVia(client *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := TunnelDialSCION(client, addr)
+	if err != nil {
+		return nil, err
+	}
+	// Identify the server by its address, as for direct connections. The
+	// address may only be resolvable by the server we tunnel through.
+	var raddr net.Addr = proxyAddr(addr)
+	if udpAddr, err := appnet.ResolveUDPAddr(addr); err == nil {
+		raddr = udpAddr
+	}
+	conn.(*chanConn).raddr = raddr
+	sshClient, err := newSSHClient(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sshClient, nil
+}
+
+// DialProxyCommand starts a client connection to the SSH server at addr,
+// using the standard input and output of the command, run with "sh -c", as
+// transport.
+func DialProxyCommand(command string, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	conn := &cmdConn{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: stdout,
+		raddr:  proxyAddr(addr),
+	}
+	client, err := newSSHClient(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// proxyAddr is the address of a server reached through a proxy.
+type proxyAddr string
+
+// Network returns the address's network name.
+func (a proxyAddr) Network() string {
+	return "proxy"
+}
+
+func (a proxyAddr) String() string {
+	return string(a)
+}
+
+// cmdConn fulfills the net.Conn interface for the standard input and output
+// of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	raddr  net.Addr
+}
+
+func (c *cmdConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *cmdConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close closes the standard input of the command and kills it.
+func (c *cmdConn) Close() error {
+	err := c.stdin.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (c *cmdConn) LocalAddr() net.Addr {
+	return proxyAddr("")
+}
+
+// RemoteAddr returns the remote network address.
+func (c *cmdConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline exists to satisfy the net.Conn interface but is not
+// implemented by this type. It always returns an error.
+func (c *cmdConn) SetDeadline(deadline time.Time) error {
+	return errors.New("scion-ssh: deadline not supported")
+}
+
+// SetReadDeadline exists to satisfy the net.Conn interface but is not
+// implemented by this type. It always returns an error.
+func (c *cmdConn) SetReadDeadline(deadline time.Time) error {
+	return errors.New("scion-ssh: deadline not supported")
+}
+
+// SetWriteDeadline exists to satisfy the net.Conn interface but is not
+// implemented by this type. It always returns an error.
+func (c *cmdConn) SetWriteDeadline(deadline time.Time) error {
+	return errors.New("scion-ssh: deadline not supported")
+}
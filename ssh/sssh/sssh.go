@@ -22,6 +22,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
+	"github.com/netsec-ethz/scion-apps/pkg/pathselection"
 	"github.com/netsec-ethz/scion-apps/ssh/quicconn"
 	"github.com/netsec-ethz/scion-apps/ssh/scionutils"
 )
@@ -36,8 +37,8 @@ func DialSCION(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
 }
 
 // DialSCION starts a client connection to the given SSH server over SCION using QUIC
-// Passes an instance of PathAppConf to the connection to make it aware of user-defined path configurations
-func DialSCIONWithConf(addr string, config *ssh.ClientConfig, appConf *scionutils.PathAppConf) (*ssh.Client, error) {
+// Passes the path selection configuration to the connection to make it aware of user-defined path configurations
+func DialSCIONWithConf(addr string, config *ssh.ClientConfig, pathConf pathselection.Config) (*ssh.Client, error) {
 	raddr, err := appnet.ResolveUDPAddr(addr)
 	if err != nil {
 		return nil, err
@@ -46,7 +47,7 @@ func DialSCIONWithConf(addr string, config *ssh.ClientConfig, appConf *scionutil
 	if err != nil {
 		return nil, err
 	}
-	policyConn := scionutils.NewPolicyConn(sconn, appConf)
+	policyConn := scionutils.NewPolicyConn(sconn, pathConf)
 	transportStream, err := quicconn.New(policyConn, raddr)
 	if err != nil {
 		return nil, err
@@ -78,7 +79,7 @@ func TunnelDialSCION(client *ssh.Client, addr string) (net.Conn, error) {
 	go ssh.DiscardRequests(requests)
 
 	return &chanConn{
-		c,
+		Channel: c,
 	}, err
 }
 
@@ -89,6 +90,7 @@ type directSCIONData struct {
 // chanConn fulfills the net.Conn interface without having to hold laddr or raddr.
 type chanConn struct {
 	ssh.Channel
+	raddr net.Addr // optional
 }
 
 // LocalAddr returns the local network address.
@@ -101,6 +103,9 @@ func (t *chanConn) LocalAddr() net.Addr {
 
 // RemoteAddr returns the remote network address.
 func (t *chanConn) RemoteAddr() net.Addr {
+	if t.raddr != nil {
+		return t.raddr
+	}
 	return &net.TCPAddr{
 		IP:   net.IPv4zero,
 		Port: 0,